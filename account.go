@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/babanini95/chirpy/internal/auth"
+	"github.com/babanini95/chirpy/internal/database"
+	"github.com/babanini95/chirpy/internal/mailer"
+	"github.com/babanini95/chirpy/internal/validate"
+)
+
+// reauthenticate loads the caller and checks their current password.
+func (cfg *apiConfig) reauthenticate(w http.ResponseWriter, r *http.Request, currentPassword string) (database.User, bool) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	user, err := cfg.queries.GetUserById(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 404, err.Error())
+		return database.User{}, false
+	}
+
+	if !cfg.checkLoginLockout(w, r, user.Email) {
+		return database.User{}, false
+	}
+	_, err = cfg.passwords.CheckPassword(user.HashedPassword, currentPassword)
+	if err != nil {
+		cfg.recordLoginFailure(r, user.Email)
+		respondWithError(w, 403, "current password is incorrect")
+		return database.User{}, false
+	}
+	return user, true
+}
+
+func (cfg *apiConfig) updateEmailHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type reqBody struct {
+		CurrentPassword string `json:"current_password"`
+		Email           string `json:"email"`
+	}
+	reqData := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&reqData)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	email, err := validate.NormalizeEmail(reqData.Email)
+	if err != nil {
+		respondWithFieldErrors(w, validate.FieldErrors{"email": err.Error()})
+		return
+	}
+
+	user, ok := cfg.reauthenticate(w, r, reqData.CurrentPassword)
+	if !ok {
+		return
+	}
+	oldEmail := user.Email
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.queries.WithTx(tx)
+
+	user, err = qtx.UpdateEmail(r.Context(), database.UpdateEmailParams{
+		Email: email,
+		ID:    user.ID,
+	})
+	if isUniqueViolation(err) {
+		respondWithFieldErrors(w, validate.FieldErrors{"email": "is already registered"})
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	// apps connected under the old address have to be connected again
+	if user.Email != oldEmail {
+		err = qtx.RevokeAllOAuthRefreshTokensByUser(r.Context(), user.ID)
+		if err != nil {
+			respondWithError(w, 500, err.Error())
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	if user.Email != oldEmail {
+		// warn the old address in case the account was taken over
+		cfg.runInBackground(r, "notifying old email address", func(ctx context.Context) error {
+			return cfg.mailer.Send(ctx, mailer.Message{
+				To:      oldEmail,
+				Subject: "Your Chirpy email address was changed",
+				Body: fmt.Sprintf(
+					"The email address of your Chirpy account was changed to %s.\n\nIf you did not do this, reset your password right away.",
+					user.Email,
+				),
+			})
+		})
+		cfg.runInBackground(r, "sending verification email", func(ctx context.Context) error {
+			return cfg.sendVerificationEmail(ctx, user)
+		})
+	}
+
+	respondWithJson(w, 200, User{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		IsChirpyRed:   isChirpyRed(user),
+		EmailVerified: user.EmailVerifiedAt.Valid,
+	})
+}
+
+// updatePasswordHandler signs out every session and answers with a new one.
+func (cfg *apiConfig) updatePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type reqBody struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	reqData := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&reqData)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	if err := cfg.passwordPolicy.Check(reqData.NewPassword); err != nil {
+		respondWithFieldErrors(w, validate.FieldErrors{"new_password": err.Error()})
+		return
+	}
+
+	user, ok := cfg.reauthenticate(w, r, reqData.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	hashedPassword, err := cfg.passwords.HashPassword(reqData.NewPassword)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.queries.WithTx(tx)
+
+	user, err = qtx.UpdatePassword(r.Context(), database.UpdatePasswordParams{
+		HashedPassword: hashedPassword,
+		ID:             user.ID,
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	err = qtx.InvalidatePasswordResetTokensByUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	err = qtx.RevokeAllRefreshTokensByUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	err = qtx.RevokeAllOAuthRefreshTokensByUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	cfg.recordLoginSuccess(r, user.Email)
+	cfg.respondWithLogin(w, r, user)
+}
+
+// deleteAccountHandler deletes the caller's account, after accountDeletionGrace when set.
+func (cfg *apiConfig) deleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type reqBody struct {
+		Password string `json:"password"`
+	}
+	reqData := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&reqData)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	user, ok := cfg.reauthenticate(w, r, reqData.Password)
+	if !ok {
+		return
+	}
+
+	if cfg.accountDeletionGrace == 0 {
+		err = cfg.queries.DeleteUserById(r.Context(), user.ID)
+		if err != nil {
+			respondWithError(w, 500, err.Error())
+			return
+		}
+		cfg.recordLoginSuccess(r, user.Email)
+		w.WriteHeader(204)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.queries.WithTx(tx)
+
+	user, err = qtx.ScheduleUserDeletion(r.Context(), database.ScheduleUserDeletionParams{
+		DeleteAfter: sql.NullTime{Time: time.Now().UTC().Add(cfg.accountDeletionGrace), Valid: true},
+		ID:          user.ID,
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	err = qtx.RevokeAllRefreshTokensByUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	err = qtx.RevokeAllAPIKeysByUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	err = qtx.RevokeAllOAuthRefreshTokensByUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	cfg.runInBackground(r, "sending account deletion notice", func(ctx context.Context) error {
+		return cfg.mailer.Send(ctx, mailer.Message{
+			To:      user.Email,
+			Subject: "Your Chirpy account will be deleted",
+			Body: fmt.Sprintf(
+				"Your Chirpy account and all your chirps will be deleted on %s.\n\nChanged your mind? Log in before then and the deletion is cancelled.",
+				user.DeleteAfter.Time.UTC().Format(time.RFC1123),
+			),
+		})
+	})
+
+	type respData struct {
+		DeleteAfter time.Time `json:"delete_after"`
+	}
+	respondWithJson(w, 202, respData{DeleteAfter: user.DeleteAfter.Time})
+}
+
+// purgeDeletedAccounts deletes accounts past their grace period every interval.
+func (cfg *apiConfig) purgeDeletedAccounts(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		emails, err := cfg.queries.DeleteUsersDueForDeletion(ctx, sql.NullTime{Time: time.Now().UTC(), Valid: true})
+		if err != nil {
+			log.Printf("purging deleted accounts: %v", err)
+		}
+		for _, email := range emails {
+			if err := cfg.accountLockout.Reset(ctx, accountLockoutKey(email)); err != nil {
+				log.Printf("purging deleted accounts: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/babanini95/chirpy/internal/auth"
+	"github.com/babanini95/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const commandUsage = "usage: chirpy promote-admin <email>"
+
+// runCommand runs an administrative command instead of the server.
+func runCommand(q *database.Queries, args []string) error {
+	switch args[0] {
+	case "promote-admin":
+		if len(args) != 2 {
+			return errors.New(commandUsage)
+		}
+		return promoteFirstAdmin(context.Background(), q, args[1])
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], commandUsage)
+	}
+}
+
+// promoteFirstAdmin makes the account with email an admin, unless one exists.
+func promoteFirstAdmin(ctx context.Context, q *database.Queries, email string) error {
+	admins, err := q.CountUsersByRole(ctx, auth.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if admins > 0 {
+		return errors.New("an admin already exists, promote further admins through the API")
+	}
+
+	user, err := findUserByEmail(ctx, q, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no user with email %s, register first", email)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = q.SetUserRole(ctx, database.SetUserRoleParams{
+		Role: auth.RoleAdmin,
+		ID:   user.ID,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is now an admin, log in again to get an admin token\n", user.Email)
+	return nil
+}
+
+func (cfg *apiConfig) setUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	userId, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		respondWithError(w, 404, err.Error())
+		return
+	}
+
+	type reqBody struct {
+		Role string `json:"role"`
+	}
+	reqData := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&reqData)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	if !auth.ValidRole(reqData.Role) {
+		respondWithError(w, 400, fmt.Sprintf("role must be one of %v", auth.Roles))
+		return
+	}
+
+	user, err := cfg.queries.SetUserRole(r.Context(), database.SetUserRoleParams{
+		Role: reqData.Role,
+		ID:   userId,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 404, "user not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	type respData struct {
+		ID   uuid.UUID `json:"id"`
+		Role string    `json:"role"`
+	}
+	respondWithJson(w, 200, respData{ID: user.ID, Role: user.Role})
+}
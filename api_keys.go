@@ -0,0 +1,232 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/babanini95/chirpy/internal/auth"
+	"github.com/babanini95/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// APIKey is a personal API key as listed to its owner. Key is only set in
+// the response that creates it.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Key        string     `json:"key,omitempty"`
+	Hint       string     `json:"hint"`
+	Scopes     []string   `json:"scopes"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func apiKeyFromDB(key database.ApiKey) APIKey {
+	apiKey := APIKey{
+		ID:        key.ID,
+		CreatedAt: key.CreatedAt,
+		Name:      key.Name,
+		Hint:      key.Hint,
+		Scopes:    strings.Fields(key.Scopes),
+	}
+	if key.LastUsedAt.Valid {
+		apiKey.LastUsedAt = &key.LastUsedAt.Time
+	}
+	return apiKey
+}
+
+// authenticate accepts a Bearer access token or an ApiKey personal API key,
+// recording that the key was used.
+func (cfg *apiConfig) authenticate(r *http.Request) (auth.Principal, error) {
+	principal, keyId, err := cfg.identify(r)
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	if keyId.Valid {
+		if err := cfg.queries.TouchAPIKey(r.Context(), keyId.UUID); err != nil {
+			log.Printf("recording api key use: %v", err)
+		}
+	}
+	return principal, nil
+}
+
+// identify is authenticate without recording key use, also returning the
+// id of the API key used, if any.
+func (cfg *apiConfig) identify(r *http.Request) (auth.Principal, uuid.NullUUID, error) {
+	key, err := auth.GetAPIKey(r.Header)
+	if err != nil {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			return auth.Principal{}, uuid.NullUUID{}, err
+		}
+		principal, err := cfg.jwtKeys.ValidateJWT(token)
+		return principal, uuid.NullUUID{}, err
+	}
+
+	apiKey, err := cfg.queries.GetAPIKeyByHash(r.Context(), auth.HashToken(key))
+	if err != nil {
+		return auth.Principal{}, uuid.NullUUID{}, errors.New("invalid api key")
+	}
+	user, err := cfg.queries.GetUserById(r.Context(), apiKey.UserID)
+	if err != nil || user.DeleteAfter.Valid {
+		return auth.Principal{}, uuid.NullUUID{}, errors.New("invalid api key")
+	}
+
+	// the key gets the owner's current role and scopes
+	allowed := auth.ScopesForRole(user.Role)
+	scopes := []string{}
+	for _, scope := range strings.Fields(apiKey.Scopes) {
+		if slices.Contains(allowed, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	principal := auth.Principal{UserID: user.ID, Role: user.Role, Scopes: scopes}
+	return principal, uuid.NullUUID{UUID: apiKey.ID, Valid: true}, nil
+}
+
+func (cfg *apiConfig) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	type reqBody struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+	reqData := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&reqData)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	reqData.Name = strings.TrimSpace(reqData.Name)
+	if reqData.Name == "" {
+		respondWithError(w, 400, "name is required")
+		return
+	}
+	if len(reqData.Scopes) == 0 {
+		respondWithError(w, 400, "at least one scope is required")
+		return
+	}
+	// a key can never do more than the credentials used to create it
+	if !principal.HasScopes(reqData.Scopes...) {
+		respondWithError(w, 403, fmt.Sprintf("scopes must be a subset of %v", principal.Scopes))
+		return
+	}
+
+	key, err := auth.MakeAPIKey()
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	dbKey, err := cfg.queries.CreateAPIKey(r.Context(), database.CreateAPIKeyParams{
+		UserID:  principal.UserID,
+		Name:    reqData.Name,
+		KeyHash: auth.HashToken(key),
+		Hint:    auth.APIKeyHint(key),
+		Scopes:  strings.Join(reqData.Scopes, " "),
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	apiKey := apiKeyFromDB(dbKey)
+	apiKey.Key = key
+	respondWithJson(w, 201, apiKey)
+}
+
+func (cfg *apiConfig) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	dbKeys, err := cfg.queries.ListAPIKeysByUser(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	keys := make([]APIKey, len(dbKeys))
+	for i, dbKey := range dbKeys {
+		keys[i] = apiKeyFromDB(dbKey)
+	}
+	respondWithJson(w, 200, keys)
+}
+
+func (cfg *apiConfig) renameAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	keyId, err := uuid.Parse(r.PathValue("keyId"))
+	if err != nil {
+		respondWithError(w, 404, err.Error())
+		return
+	}
+
+	type reqBody struct {
+		Name string `json:"name"`
+	}
+	reqData := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&reqData)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	reqData.Name = strings.TrimSpace(reqData.Name)
+	if reqData.Name == "" {
+		respondWithError(w, 400, "name is required")
+		return
+	}
+
+	dbKey, err := cfg.queries.RenameAPIKey(r.Context(), database.RenameAPIKeyParams{
+		Name:   reqData.Name,
+		ID:     keyId,
+		UserID: principal.UserID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 404, "api key not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	respondWithJson(w, 200, apiKeyFromDB(dbKey))
+}
+
+func (cfg *apiConfig) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	keyId, err := uuid.Parse(r.PathValue("keyId"))
+	if err != nil {
+		respondWithError(w, 404, err.Error())
+		return
+	}
+
+	// scoping by user id means another user's key looks like a missing one
+	revoked, err := cfg.queries.RevokeAPIKey(r.Context(), database.RevokeAPIKeyParams{
+		ID:     keyId,
+		UserID: principal.UserID,
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, 404, "api key not found")
+		return
+	}
+
+	w.WriteHeader(204)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/babanini95/chirpy/internal/auth"
+	"github.com/babanini95/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// ChirpRevision is an earlier body of an edited chirp.
+type ChirpRevision struct {
+	ID         uuid.UUID `json:"id"`
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+// updateChirpHandler edits a chirp, keeping its previous body.
+func (cfg *apiConfig) updateChirpHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		respondWithError(w, 404, err.Error())
+		return
+	}
+
+	type reqBody struct {
+		Body string `json:"body"`
+	}
+	reqData := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&reqData)
+	if err != nil {
+		respondWithError(w, 400, "invalid request body")
+		return
+	}
+
+	user, err := cfg.queries.GetUserById(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 401, err.Error())
+		return
+	}
+	if cfg.requireVerifiedEmail && !user.EmailVerifiedAt.Valid {
+		respondWithError(w, 403, "verify your email address before chirping")
+		return
+	}
+	entitlements := entitlementsFor(user)
+	if cfg.chirpEditingRequiresRed && !entitlements.CanEditChirps {
+		respondWithError(w, 403, "editing chirps requires Chirpy Red")
+		return
+	}
+	if utf8.RuneCountInString(reqData.Body) > entitlements.MaxChirpLength {
+		respondWithError(w, 400, fmt.Sprintf("chirp is too long, the limit is %d characters", entitlements.MaxChirpLength))
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.queries.WithTx(tx)
+
+	// the row stays locked until commit
+	chirp, err := qtx.GetChirpByIdForUpdate(r.Context(), chirpId)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 404, "chirp not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	if chirp.UserID != principal.UserID {
+		respondWithError(w, 403, "can't edit others chirp")
+		return
+	}
+	// the window starts when the chirp is published
+	if cfg.chirpEditWindow > 0 && time.Now().UTC().After(chirp.PublishAt.Add(cfg.chirpEditWindow)) {
+		respondWithError(w, 403, fmt.Sprintf("chirps can only be edited within %v of posting", cfg.chirpEditWindow))
+		return
+	}
+
+	cleanedBody := censorChirp(reqData.Body, profaneWords)
+	if cleanedBody == chirp.Body {
+		cfg.respondWithChirp(w, r, chirp)
+		return
+	}
+
+	now := time.Now().UTC()
+	err = qtx.CreateChirpRevision(r.Context(), database.CreateChirpRevisionParams{
+		ChirpID:    chirp.ID,
+		Body:       chirp.Body,
+		CreatedAt:  chirp.UpdatedAt,
+		ReplacedAt: now,
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	chirp, err = qtx.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+		Body:      cleanedBody,
+		UpdatedAt: now,
+		ID:        chirp.ID,
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	cfg.respondWithChirp(w, r, chirp)
+}
+
+// chirpHistoryHandler lists the earlier bodies of a chirp, newest first.
+func (cfg *apiConfig) chirpHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	chirp, ok := cfg.publishedChirp(w, r)
+	if !ok {
+		return
+	}
+
+	dbRevisions, err := cfg.queries.ListChirpRevisions(r.Context(), chirp.ID)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	revisions := make([]ChirpRevision, len(dbRevisions))
+	for i, revision := range dbRevisions {
+		revisions[i] = ChirpRevision{
+			ID:         revision.ID,
+			Body:       revision.Body,
+			CreatedAt:  revision.CreatedAt,
+			ReplacedAt: revision.ReplacedAt,
+		}
+	}
+	respondWithJson(w, 200, revisions)
+}
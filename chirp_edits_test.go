@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/babanini95/chirpy/internal/auth"
+	"github.com/babanini95/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+var chirpLikeStatsColumns = []string{"chirp_id", "like_count", "liked_by_me"}
+
+func TestUpdateChirpHandler(t *testing.T) {
+	now := time.Now().UTC()
+	verified := sql.NullTime{Time: now.Add(-time.Hour), Valid: true}
+	red := sql.NullTime{Time: now.Add(time.Hour), Valid: true}
+
+	tests := []struct {
+		name         string
+		requireRed   bool
+		window       time.Duration
+		user         database.User
+		author       uuid.UUID
+		publishedAgo time.Duration
+		body         string
+		expected     int
+	}{
+		{name: "unverified email", user: database.User{}, body: "new", expected: 403},
+		{name: "free plan when editing needs Red", requireRed: true, user: database.User{EmailVerifiedAt: verified}, body: "new", expected: 403},
+		{name: "Red plan when editing needs Red", requireRed: true, user: database.User{EmailVerifiedAt: verified, ChirpyRedUntil: red}, body: "new", expected: 200},
+		{name: "someone else's chirp", user: database.User{EmailVerifiedAt: verified}, author: uuid.New(), body: "new", expected: 403},
+		{name: "after the edit window", window: time.Minute, user: database.User{EmailVerifiedAt: verified}, publishedAgo: time.Hour, body: "new", expected: 403},
+		{name: "within the edit window", window: time.Hour, user: database.User{EmailVerifiedAt: verified}, publishedAgo: time.Minute, body: "new", expected: 200},
+		{name: "unchanged body", user: database.User{EmailVerifiedAt: verified}, body: "old", expected: 200},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, mock := newTestConfig(t)
+			cfg.requireVerifiedEmail = true
+			cfg.chirpEditingRequiresRed = test.requireRed
+			cfg.chirpEditWindow = test.window
+
+			user := test.user
+			user.ID = uuid.New()
+			user.Role = auth.RoleUser
+			author := test.author
+			if author == uuid.Nil {
+				author = user.ID
+			}
+			published := now.Add(-test.publishedAgo)
+			chirp := database.Chirp{ID: uuid.New(), CreatedAt: published, UpdatedAt: published, Body: "old", UserID: author, PublishAt: published}
+			edited := chirp
+			edited.Body = test.body
+			edited.UpdatedAt = now
+			edited.EditedAt = sql.NullTime{Time: now, Valid: true}
+
+			mock.ExpectQuery(queryName("GetUserById")).WillReturnRows(userRows(user))
+			mock.ExpectBegin()
+			mock.ExpectQuery(queryName("GetChirpByIdForUpdate")).WillReturnRows(chirpRows(chirp))
+			mock.ExpectExec(queryName("CreateChirpRevision")).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(queryName("UpdateChirpBody")).WillReturnRows(chirpRows(edited))
+			mock.ExpectCommit()
+			mock.ExpectQuery(queryName("GetChirpLikeStats")).WillReturnRows(mockRows(chirpLikeStatsColumns))
+
+			r := httptest.NewRequest("PUT", "/api/chirps/"+chirp.ID.String(), strings.NewReader(`{"body": "`+test.body+`"}`))
+			r.SetPathValue("chirpId", chirp.ID.String())
+			r = withPrincipal(r, auth.Principal{UserID: user.ID, Role: auth.RoleUser, Scopes: auth.DefaultScopes})
+			w := httptest.NewRecorder()
+			cfg.updateChirpHandler(w, r)
+
+			if w.Code != test.expected {
+				t.Fatalf("got %d, expected %d: %s", w.Code, test.expected, w.Body)
+			}
+			if test.expected != 200 {
+				return
+			}
+			var got Chirp
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Body != test.body {
+				t.Errorf("got body %q, expected %q", got.Body, test.body)
+			}
+		})
+	}
+}
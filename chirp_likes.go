@@ -0,0 +1,167 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/babanini95/chirpy/internal/auth"
+	"github.com/babanini95/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// ChirpLike is one user's like on a chirp.
+type ChirpLike struct {
+	UserID  uuid.UUID `json:"user_id"`
+	LikedAt time.Time `json:"liked_at"`
+}
+
+// viewerID identifies the reader of a public route, if signed in, without
+// counting it as a use of their API key.
+func (cfg *apiConfig) viewerID(r *http.Request) uuid.NullUUID {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		var err error
+		principal, _, err = cfg.identify(r)
+		if err != nil {
+			return uuid.NullUUID{}
+		}
+	}
+	return uuid.NullUUID{UUID: principal.UserID, Valid: true}
+}
+
+// addLikes fills in the like counts of chirps with a single query.
+func (cfg *apiConfig) addLikes(r *http.Request, chirps []Chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(chirps))
+	for i, c := range chirps {
+		ids[i] = c.ID
+	}
+	stats, err := cfg.queries.GetChirpLikeStats(r.Context(), database.GetChirpLikeStatsParams{
+		ViewerID: cfg.viewerID(r),
+		ChirpIds: ids,
+	})
+	if err != nil {
+		return err
+	}
+
+	byChirp := make(map[uuid.UUID]database.GetChirpLikeStatsRow, len(stats))
+	for _, s := range stats {
+		byChirp[s.ChirpID] = s
+	}
+	for i := range chirps {
+		s := byChirp[chirps[i].ID]
+		chirps[i].LikeCount = s.LikeCount
+		chirps[i].LikedByMe = s.LikedByMe
+	}
+	return nil
+}
+
+// likeChirpHandler likes a chirp. Liking it again changes nothing.
+func (cfg *apiConfig) likeChirpHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	chirp, ok := cfg.publishedChirp(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.queries.LikeChirp(r.Context(), database.LikeChirpParams{
+		ChirpID: chirp.ID,
+		UserID:  principal.UserID,
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// unlikeChirpHandler takes back a like, if there is one.
+func (cfg *apiConfig) unlikeChirpHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	chirp, ok := cfg.publishedChirp(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.queries.UnlikeChirp(r.Context(), database.UnlikeChirpParams{
+		ChirpID: chirp.ID,
+		UserID:  principal.UserID,
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// chirpLikesHandler lists who liked a chirp, most recent first, a page at a
+// time. A Link header points at the next page.
+func (cfg *apiConfig) chirpLikesHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	chirp, ok := cfg.publishedChirp(w, r)
+	if !ok {
+		return
+	}
+
+	params := database.ListChirpLikesParams{ChirpID: chirp.ID}
+	limit, err := parseLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	// fetch one extra row to know whether another page exists
+	params.Limit = int32(limit + 1)
+
+	// a like is found by its (created_at, user_id) pair the way a chirp is
+	// by (publish_at, id), so they share the cursor format
+	if after := r.URL.Query().Get("after"); after != "" {
+		cursor, err := decodeCursor(after)
+		if err != nil {
+			respondWithError(w, 400, err.Error())
+			return
+		}
+		params.CursorCreatedAt = sql.NullTime{Time: cursor.PublishAt, Valid: true}
+		params.CursorUserID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	dbLikes, err := cfg.queries.ListChirpLikes(r.Context(), params)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	hasMore := len(dbLikes) > limit
+	if hasMore {
+		dbLikes = dbLikes[:limit]
+		last := chirpCursor{PublishAt: dbLikes[limit-1].CreatedAt, ID: dbLikes[limit-1].UserID}
+		w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="next"`, pageLink(r.URL, "after", last)))
+	}
+
+	likes := make([]ChirpLike, len(dbLikes))
+	for i, like := range dbLikes {
+		likes[i] = ChirpLike{
+			UserID:  like.UserID,
+			LikedAt: like.CreatedAt,
+		}
+	}
+	respondWithJson(w, 200, likes)
+}
+
+// respondWithChirp answers a single chirp along with its likes.
+func (cfg *apiConfig) respondWithChirp(w http.ResponseWriter, r *http.Request, c database.Chirp) {
+	chirps := []Chirp{chirpFromDB(c)}
+	if err := cfg.addLikes(r, chirps); err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	respondWithJson(w, 200, chirps[0])
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/babanini95/chirpy/internal/auth"
+	"github.com/babanini95/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestLikeAndUnlikeAreIdempotent(t *testing.T) {
+	cfg, mock := newTestConfig(t)
+	now := time.Now().UTC()
+	chirp := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "hi", UserID: uuid.New(), PublishAt: now}
+	userID := uuid.New()
+
+	// the second like and the second unlike change no rows, and answer the
+	// same as the first
+	steps := []struct {
+		name     string
+		query    string
+		affected int64
+		unlike   bool
+	}{
+		{"like", "LikeChirp", 1, false},
+		{"like again", "LikeChirp", 0, false},
+		{"unlike", "UnlikeChirp", 1, true},
+		{"unlike again", "UnlikeChirp", 0, true},
+	}
+	for _, step := range steps {
+		mock.ExpectQuery(queryName("GetChirpById")).WillReturnRows(chirpRows(chirp))
+		mock.ExpectExec(queryName(step.query)).WillReturnResult(sqlmock.NewResult(0, step.affected))
+
+		r := httptest.NewRequest("POST", "/api/chirps/"+chirp.ID.String()+"/likes", nil)
+		r.SetPathValue("chirpId", chirp.ID.String())
+		r = withPrincipal(r, auth.Principal{UserID: userID, Role: auth.RoleUser, Scopes: auth.DefaultScopes})
+		w := httptest.NewRecorder()
+		if step.unlike {
+			cfg.unlikeChirpHandler(w, r)
+		} else {
+			cfg.likeChirpHandler(w, r)
+		}
+
+		if w.Code != 204 {
+			t.Errorf("%s: got %d, expected 204: %s", step.name, w.Code, w.Body)
+		}
+	}
+}
+
+func TestAddLikesLikedByMe(t *testing.T) {
+	viewer := uuid.New()
+	liked, notLiked := Chirp{ID: uuid.New()}, Chirp{ID: uuid.New()}
+
+	tests := []struct {
+		name     string
+		header   string
+		signedIn bool
+	}{
+		{name: "anonymous reader"},
+		{name: "signed in through middleware", signedIn: true},
+		{name: "api key on a public route", header: "ApiKey key"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, mock := newTestConfig(t)
+			now := time.Now().UTC()
+
+			var viewerArg any
+			if test.signedIn || test.header != "" {
+				viewerArg = viewer.String()
+			}
+			if test.header != "" {
+				// reading with a key looks it up but must not record a use
+				mock.ExpectQuery(queryName("GetAPIKeyByHash")).WillReturnRows(mockRows(apiKeyColumns, []any{
+					uuid.New(), now, viewer, "bot", auth.HashToken("key"), "key", auth.ScopeChirpsWrite, nil, nil,
+				}))
+				mock.ExpectQuery(queryName("GetUserById")).WillReturnRows(userRows(database.User{
+					ID: viewer, CreatedAt: now, UpdatedAt: now, Email: "bot@example.com", Role: auth.RoleUser,
+				}))
+			}
+			mock.ExpectQuery(queryName("GetChirpLikeStats")).
+				WillReturnRows(mockRows(chirpLikeStatsColumns, []any{liked.ID, int64(2), viewerArg != nil}))
+
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			r := httptest.NewRequest("GET", "/api/chirps", nil)
+			if test.header != "" {
+				r.Header.Set("Authorization", test.header)
+			}
+			if test.signedIn {
+				r = withPrincipal(r, auth.Principal{UserID: viewer, Role: auth.RoleUser})
+			}
+			chirps := []Chirp{liked, notLiked}
+			if err := cfg.addLikes(r, chirps); err != nil {
+				t.Fatal(err)
+			}
+
+			if chirps[0].LikeCount != 2 || chirps[0].LikedByMe != (viewerArg != nil) {
+				t.Errorf("got %d likes, liked by me %v", chirps[0].LikeCount, chirps[0].LikedByMe)
+			}
+			if chirps[1].LikeCount != 0 || chirps[1].LikedByMe {
+				t.Errorf("expected no likes on a chirp without any, got %+v", chirps[1])
+			}
+			if logs.Len() > 0 {
+				t.Errorf("expected no writes, got %s", logs.String())
+			}
+		})
+	}
+}
+
+func TestChirpLikesHandlerPages(t *testing.T) {
+	now := time.Now().UTC()
+	chirp := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "hi", UserID: uuid.New(), PublishAt: now}
+	likeColumns := []string{"chirp_id", "user_id", "created_at"}
+	first := []any{chirp.ID, uuid.New(), now.Add(-time.Minute)}
+	second := []any{chirp.ID, uuid.New(), now.Add(-time.Hour)}
+
+	tests := []struct {
+		name     string
+		rows     [][]any
+		expected []any
+		hasMore  bool
+	}{
+		{"more likes than the limit", [][]any{first, second}, first, true},
+		{"last page", [][]any{second}, second, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, mock := newTestConfig(t)
+			mock.ExpectQuery(queryName("GetChirpById")).WillReturnRows(chirpRows(chirp))
+			mock.ExpectQuery(queryName("ListChirpLikes")).WillReturnRows(mockRows(likeColumns, test.rows...))
+
+			r := httptest.NewRequest("GET", "/api/chirps/"+chirp.ID.String()+"/likes?limit=1", nil)
+			r.SetPathValue("chirpId", chirp.ID.String())
+			w := httptest.NewRecorder()
+			cfg.chirpLikesHandler(w, r)
+
+			if w.Code != 200 {
+				t.Fatalf("got %d, expected 200: %s", w.Code, w.Body)
+			}
+			body := w.Body.String()
+			if !strings.Contains(body, test.expected[1].(uuid.UUID).String()) || strings.Count(body, "user_id") != 1 {
+				t.Errorf("expected only the like of %v, got %s", test.expected[1], body)
+			}
+			if link := w.Header().Get("Link"); strings.HasSuffix(link, `>; rel="next"`) != test.hasMore {
+				t.Errorf("got link %q, expected one: %v", link, test.hasMore)
+			}
+		})
+	}
+}
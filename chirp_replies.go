@@ -0,0 +1,180 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/babanini95/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxThreadDepth is how many levels a thread reaches up and down.
+	maxThreadDepth = 20
+	// maxThreadReplies caps the replies answered with a thread.
+	maxThreadReplies = 500
+)
+
+// ChirpThread is a chirp with the chirps it replies to and its replies.
+type ChirpThread struct {
+	Ancestors []Chirp       `json:"ancestors"`
+	Chirp     ThreadedChirp `json:"chirp"`
+}
+
+// ThreadedChirp is a chirp with its replies nested under it.
+type ThreadedChirp struct {
+	Chirp
+	Replies []*ThreadedChirp `json:"replies"`
+}
+
+// publishedChirp looks up the published chirp in the path.
+func (cfg *apiConfig) publishedChirp(w http.ResponseWriter, r *http.Request) (database.Chirp, bool) {
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		respondWithError(w, 404, err.Error())
+		return database.Chirp{}, false
+	}
+
+	chirp, err := cfg.queries.GetChirpById(r.Context(), chirpId)
+	if err != nil {
+		respondWithError(w, 404, err.Error())
+		return database.Chirp{}, false
+	}
+	// scheduled chirps stay hidden until they are published
+	if chirp.PublishAt.After(time.Now().UTC()) {
+		respondWithError(w, 404, "chirp not found")
+		return database.Chirp{}, false
+	}
+	return chirp, true
+}
+
+// chirpRepliesHandler lists the direct replies to a chirp, oldest first, a
+// page at a time. A Link header points at the next page.
+func (cfg *apiConfig) chirpRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	chirp, ok := cfg.publishedChirp(w, r)
+	if !ok {
+		return
+	}
+
+	params := database.ListChirpRepliesParams{
+		ChirpID: chirp.ID,
+		Now:     time.Now().UTC(),
+	}
+	limit, err := parseLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	// fetch one extra row to know whether another page exists
+	params.Limit = int32(limit + 1)
+
+	if after := r.URL.Query().Get("after"); after != "" {
+		cursor, err := decodeCursor(after)
+		if err != nil {
+			respondWithError(w, 400, err.Error())
+			return
+		}
+		params.CursorPublishAt = sql.NullTime{Time: cursor.PublishAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	cs, err := cfg.queries.ListChirpReplies(r.Context(), params)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	hasMore := len(cs) > limit
+	if hasMore {
+		cs = cs[:limit]
+	}
+
+	replies := make([]Chirp, len(cs))
+	for i, c := range cs {
+		replies[i] = chirpFromDB(c)
+	}
+	if err := cfg.addLikes(r, replies); err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	if hasMore {
+		last := chirpCursor{PublishAt: cs[len(cs)-1].PublishAt, ID: cs[len(cs)-1].ID}
+		w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="next"`, pageLink(r.URL, "after", last)))
+	}
+	respondWithJson(w, 200, replies)
+}
+
+// chirpThreadHandler answers the conversation around a chirp, up to
+// maxThreadDepth levels either way and maxThreadReplies replies.
+func (cfg *apiConfig) chirpThreadHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	chirp, ok := cfg.publishedChirp(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := cfg.queries.GetChirpThread(r.Context(), database.GetChirpThreadParams{
+		ID:         chirp.ID,
+		MaxDepth:   maxThreadDepth,
+		Now:        time.Now().UTC(),
+		MaxReplies: maxThreadReplies,
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	chirps := make([]Chirp, len(rows))
+	depths := make([]int32, len(rows))
+	for i, row := range rows {
+		chirps[i] = chirpFromDB(database.Chirp{
+			ID:          row.ID,
+			CreatedAt:   row.CreatedAt,
+			UpdatedAt:   row.UpdatedAt,
+			Body:        row.Body,
+			UserID:      row.UserID,
+			EditedAt:    row.EditedAt,
+			InReplyToID: row.InReplyToID,
+			PublishAt:   row.PublishAt,
+		})
+		depths[i] = row.Depth
+	}
+	if err := cfg.addLikes(r, chirps); err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	respondWithJson(w, 200, buildThread(chirps, depths))
+}
+
+// buildThread nests chirps ordered by depth, leaving out replies whose
+// parent is missing.
+func buildThread(chirps []Chirp, depths []int32) ChirpThread {
+	thread := ChirpThread{Ancestors: []Chirp{}}
+	nodes := make(map[uuid.UUID]*ThreadedChirp, len(chirps))
+	for i, c := range chirps {
+		switch {
+		case depths[i] < 0:
+			thread.Ancestors = append(thread.Ancestors, c)
+		case depths[i] == 0:
+			thread.Chirp = ThreadedChirp{Chirp: c, Replies: []*ThreadedChirp{}}
+			nodes[c.ID] = &thread.Chirp
+		default:
+			if c.InReplyToID == nil {
+				continue
+			}
+			parent, ok := nodes[*c.InReplyToID]
+			if !ok {
+				continue
+			}
+			node := &ThreadedChirp{Chirp: c, Replies: []*ThreadedChirp{}}
+			parent.Replies = append(parent.Replies, node)
+			nodes[c.ID] = node
+		}
+	}
+	return thread
+}
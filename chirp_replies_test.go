@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/babanini95/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestBuildThread(t *testing.T) {
+	chirp := func(parent *Chirp) Chirp {
+		c := Chirp{ID: uuid.New()}
+		if parent != nil {
+			c.InReplyToID = &parent.ID
+		}
+		return c
+	}
+	root := chirp(nil)
+	parent := chirp(&root)
+	focus := chirp(&parent)
+	reply := chirp(&focus)
+	otherReply := chirp(&focus)
+	nested := chirp(&reply)
+	// its parent was cut off by the reply limit
+	orphan := chirp(&Chirp{ID: uuid.New()})
+
+	thread := buildThread(
+		[]Chirp{root, parent, focus, reply, otherReply, nested, orphan},
+		[]int32{-2, -1, 0, 1, 1, 2, 2},
+	)
+
+	if len(thread.Ancestors) != 2 || thread.Ancestors[0].ID != root.ID || thread.Ancestors[1].ID != parent.ID {
+		t.Errorf("expected the ancestors oldest first, got %+v", thread.Ancestors)
+	}
+	if thread.Chirp.ID != focus.ID {
+		t.Fatalf("got chirp %v, expected %v", thread.Chirp.ID, focus.ID)
+	}
+	replies := thread.Chirp.Replies
+	if len(replies) != 2 || replies[0].ID != reply.ID || replies[1].ID != otherReply.ID {
+		t.Fatalf("expected both direct replies in order, got %+v", replies)
+	}
+	if len(replies[0].Replies) != 1 || replies[0].Replies[0].ID != nested.ID {
+		t.Errorf("expected the nested reply under its parent, got %+v", replies[0].Replies)
+	}
+	if replies[1].Replies == nil || replies[0].Replies[0].Replies == nil {
+		t.Errorf("replies without replies of their own should hold an empty list")
+	}
+}
+
+func TestBuildThreadWithoutAncestors(t *testing.T) {
+	focus := Chirp{ID: uuid.New()}
+	data, err := json.Marshal(buildThread([]Chirp{focus}, []int32{0}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"ancestors":[]`, `"replies":[]`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected %s in %s", want, data)
+		}
+	}
+}
+
+func TestChirpRepliesHandlerPages(t *testing.T) {
+	cfg, mock := newTestConfig(t)
+	now := time.Now().UTC()
+	chirp := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "hi", UserID: uuid.New(), PublishAt: now.Add(-time.Hour)}
+	replies := make([]database.Chirp, 3)
+	for i := range replies {
+		at := chirp.PublishAt.Add(time.Duration(i+1) * time.Minute)
+		replies[i] = database.Chirp{
+			ID:          uuid.New(),
+			CreatedAt:   at,
+			UpdatedAt:   at,
+			Body:        "reply",
+			UserID:      uuid.New(),
+			InReplyToID: uuid.NullUUID{UUID: chirp.ID, Valid: true},
+			PublishAt:   at,
+		}
+	}
+
+	mock.ExpectQuery(queryName("GetChirpById")).WillReturnRows(chirpRows(chirp))
+	mock.ExpectQuery(queryName("ListChirpReplies")).WillReturnRows(chirpRows(replies...))
+	mock.ExpectQuery(queryName("GetChirpLikeStats")).WillReturnRows(mockRows(chirpLikeStatsColumns))
+
+	r := httptest.NewRequest("GET", "/api/chirps/"+chirp.ID.String()+"/replies?limit=2", nil)
+	r.SetPathValue("chirpId", chirp.ID.String())
+	w := httptest.NewRecorder()
+	cfg.chirpRepliesHandler(w, r)
+
+	if w.Code != 200 {
+		t.Fatalf("got %d, expected 200: %s", w.Code, w.Body)
+	}
+	var got []Chirp
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].ID != replies[0].ID || got[1].ID != replies[1].ID {
+		t.Errorf("expected the first two replies, got %+v", got)
+	}
+	if link := w.Header().Get("Link"); !strings.HasSuffix(link, `>; rel="next"`) {
+		t.Errorf("expected a next link, got %q", link)
+	}
+}
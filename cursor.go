@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultChirpsLimit = 20
+	maxChirpsLimit     = 100
+)
+
+// chirpCursor points at a chirp in the (publish_at, id) ordering.
+type chirpCursor struct {
+	PublishAt time.Time
+	ID        uuid.UUID
+}
+
+func encodeCursor(c chirpCursor) string {
+	raw := c.PublishAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (chirpCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return chirpCursor{}, fmt.Errorf("invalid cursor")
+	}
+
+	publishAt, id, found := strings.Cut(string(raw), "|")
+	if !found {
+		return chirpCursor{}, fmt.Errorf("invalid cursor")
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, publishAt)
+	if err != nil {
+		return chirpCursor{}, fmt.Errorf("invalid cursor")
+	}
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return chirpCursor{}, fmt.Errorf("invalid cursor")
+	}
+
+	return chirpCursor{PublishAt: t, ID: u}, nil
+}
+
+// parseLimit reads the limit query parameter, within 1..maxChirpsLimit.
+func parseLimit(s string) (int, error) {
+	if s == "" {
+		return defaultChirpsLimit, nil
+	}
+
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit < 1 || limit > maxChirpsLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxChirpsLimit)
+	}
+	return limit, nil
+}
+
+// pageLink rebuilds the request URL with param set and opposite removed.
+func pageLink(u *url.URL, param string, c chirpCursor) string {
+	q := u.Query()
+	q.Del("after")
+	q.Del("before")
+	q.Set(param, encodeCursor(c))
+
+	link := url.URL{Path: u.Path, RawQuery: q.Encode()}
+	return link.String()
+}
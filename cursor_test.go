@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	want := chirpCursor{
+		PublishAt: time.Date(2025, 6, 1, 12, 30, 45, 123456000, time.UTC),
+		ID:        uuid.New(),
+	}
+
+	got, err := decodeCursor(encodeCursor(want))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.PublishAt.Equal(want.PublishAt) || got.ID != want.ID {
+		t.Errorf("got %+v, expected %+v", got, want)
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"not base64", "%%%"},
+		{"missing separator", "bm9wZQ"},
+		{"bad uuid", encodeCursor(chirpCursor{PublishAt: time.Now()})[:20]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := decodeCursor(test.input); err == nil {
+				t.Errorf("expected error for %q", test.input)
+			}
+		})
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected int
+		wantErr  bool
+	}{
+		{"default", "", defaultChirpsLimit, false},
+		{"valid", "5", 5, false},
+		{"zero", "0", 0, true},
+		{"too big", "1000", 0, true},
+		{"not a number", "ten", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limit, err := parseLimit(test.input)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got err %v, wantErr %v", err, test.wantErr)
+			}
+			if limit != test.expected {
+				t.Errorf("got %d, expected %d", limit, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/babanini95/chirpy/internal/auth"
+	"github.com/babanini95/chirpy/internal/database"
+	"github.com/babanini95/chirpy/internal/mailer"
+)
+
+const emailVerificationTTL = 24 * time.Hour
+
+// sendVerificationEmail mails a link that verifies the user's current address.
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, user database.User) error {
+	verifyToken, err := auth.MakeOpaqueToken()
+	if err != nil {
+		return err
+	}
+	_, err = cfg.queries.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(verifyToken),
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: time.Now().UTC().Add(emailVerificationTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/app/verify-email?token=%s", cfg.baseURL, url.QueryEscape(verifyToken))
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf(
+			"Welcome to Chirpy!\n\nConfirm this is your address within %v by opening:\n%s",
+			emailVerificationTTL,
+			link,
+		),
+	})
+}
+
+func (cfg *apiConfig) verifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type reqBody struct {
+		Token string `json:"token"`
+	}
+	reqData := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&reqData)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.queries.WithTx(tx)
+
+	verifyToken, err := qtx.ConsumeEmailVerificationToken(r.Context(), database.ConsumeEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(reqData.Token),
+		Now:       time.Now().UTC(),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 400, "invalid or expired verification token")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	user, err := qtx.MarkEmailVerified(r.Context(), database.MarkEmailVerifiedParams{
+		ID:    verifyToken.UserID,
+		Email: verifyToken.Email,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 400, "email address has changed since this link was sent")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	respondWithJson(w, 200, User{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		IsChirpyRed:   isChirpyRed(user),
+		EmailVerified: user.EmailVerifiedAt.Valid,
+	})
+}
+
+func (cfg *apiConfig) resendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	user, err := cfg.queries.GetUserById(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 404, err.Error())
+		return
+	}
+	if user.EmailVerifiedAt.Valid {
+		respondWithError(w, 409, "email already verified")
+		return
+	}
+	if !cfg.checkMailLimit(w, r, "verification", user.Email) {
+		return
+	}
+
+	err = cfg.sendVerificationEmail(r.Context(), user)
+	if err != nil {
+		log.Printf("sending verification email: %v", err)
+		respondWithError(w, 500, "can not send verification email")
+		return
+	}
+
+	w.WriteHeader(202)
+}
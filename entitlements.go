@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/babanini95/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Entitlements are the perks and limits of an account's plan.
+type Entitlements struct {
+	MaxChirpLength int
+	// ChirpsPerHour counts chirps created, including scheduled chirps that
+	// are not published yet.
+	ChirpsPerHour int64
+	CanEditChirps bool
+	// ScheduleAhead is how far in the future chirps may be scheduled; zero
+	// means they can not be.
+	ScheduleAhead time.Duration
+	// Badge is shown on the public profile, empty for none.
+	Badge string
+}
+
+var (
+	freeEntitlements = Entitlements{
+		MaxChirpLength: 140,
+		ChirpsPerHour:  30,
+	}
+	chirpyRedEntitlements = Entitlements{
+		MaxChirpLength: 1000,
+		ChirpsPerHour:  300,
+		CanEditChirps:  true,
+		ScheduleAhead:  30 * 24 * time.Hour,
+		Badge:          "chirpy_red",
+	}
+)
+
+func entitlementsFor(user database.User) Entitlements {
+	if isChirpyRed(user) {
+		return chirpyRedEntitlements
+	}
+	return freeEntitlements
+}
+
+func isChirpyRed(user database.User) bool {
+	return user.ChirpyRedUntil.Valid && user.ChirpyRedUntil.Time.After(time.Now().UTC())
+}
+
+// Profile is the public view of a user.
+type Profile struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Badge     string    `json:"badge,omitempty"`
+}
+
+func (cfg *apiConfig) getProfileHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	userId, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		respondWithError(w, 404, err.Error())
+		return
+	}
+
+	user, err := cfg.queries.GetUserById(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, 404, "user not found")
+		return
+	}
+
+	respondWithJson(w, 200, Profile{
+		ID:        user.ID,
+		CreatedAt: user.CreatedAt,
+		Badge:     entitlementsFor(user).Badge,
+	})
+}
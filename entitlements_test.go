@@ -0,0 +1,31 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/babanini95/chirpy/internal/database"
+)
+
+func TestEntitlementsFor(t *testing.T) {
+	now := time.Now().UTC()
+	tests := []struct {
+		name     string
+		until    sql.NullTime
+		expected Entitlements
+	}{
+		{"never subscribed", sql.NullTime{}, freeEntitlements},
+		{"subscription running", sql.NullTime{Time: now.Add(time.Hour), Valid: true}, chirpyRedEntitlements},
+		{"subscription ran out", sql.NullTime{Time: now.Add(-time.Hour), Valid: true}, freeEntitlements},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := entitlementsFor(database.User{ChirpyRedUntil: test.until})
+			if got != test.expected {
+				t.Errorf("got %+v, expected %+v", got, test.expected)
+			}
+		})
+	}
+}
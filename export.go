@@ -0,0 +1,121 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/babanini95/chirpy/internal/auth"
+	"github.com/babanini95/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// exportProfile is the stored user without secrets.
+type exportProfile struct {
+	ID               uuid.UUID  `json:"id"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	Email            string     `json:"email"`
+	EmailVerifiedAt  *time.Time `json:"email_verified_at"`
+	IsChirpyRed      bool       `json:"is_chirpy_red"`
+	ChirpyRedUntil   *time.Time `json:"chirpy_red_until,omitempty"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	DeleteAfter      *time.Time `json:"delete_after,omitempty"`
+}
+
+// exportAccountHandler streams profile.json, chirps.json and sessions.json as a ZIP archive.
+func (cfg *apiConfig) exportAccountHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	user, err := cfg.queries.GetUserById(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 404, err.Error())
+		return
+	}
+	dbChirps, err := cfg.queries.GetChirpsByUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	sessionRows, err := cfg.queries.GetRefreshTokensByUser(r.Context(), database.GetRefreshTokensByUserParams{
+		UserID: user.ID,
+		Now:    time.Now().UTC(),
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	profile := exportProfile{
+		ID:               user.ID,
+		CreatedAt:        user.CreatedAt,
+		UpdatedAt:        user.UpdatedAt,
+		Email:            user.Email,
+		IsChirpyRed:      isChirpyRed(user),
+		TwoFactorEnabled: user.TotpEnabledAt.Valid,
+	}
+	if user.EmailVerifiedAt.Valid {
+		profile.EmailVerifiedAt = &user.EmailVerifiedAt.Time
+	}
+	if user.ChirpyRedUntil.Valid {
+		profile.ChirpyRedUntil = &user.ChirpyRedUntil.Time
+	}
+	if user.DeleteAfter.Valid {
+		profile.DeleteAfter = &user.DeleteAfter.Time
+	}
+
+	chirps := make([]Chirp, len(dbChirps))
+	for i, chirp := range dbChirps {
+		chirps[i] = chirpFromDB(chirp)
+	}
+	if err := cfg.addLikes(r, chirps); err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	now := time.Now()
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chirpy-export-%s.zip"`, now.Format("2006-01-02")))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(200)
+
+	archive := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", profile},
+		{"chirps.json", chirps},
+		{"sessions.json", sessionsFromRows(sessionRows)},
+	}
+	for _, file := range files {
+		err = writeExportFile(archive, file.name, file.data, now)
+		if err != nil {
+			// the status is already sent, all that is left is a broken archive
+			log.Printf("writing export for user %s: %v", user.ID, err)
+			return
+		}
+	}
+	if err = archive.Close(); err != nil {
+		log.Printf("writing export for user %s: %v", user.ID, err)
+	}
+}
+
+func writeExportFile(archive *zip.Writer, name string, data any, modified time.Time) error {
+	f, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
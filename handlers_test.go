@@ -0,0 +1,235 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/babanini95/chirpy/internal/auth"
+	"github.com/babanini95/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// newTestConfig gives an apiConfig backed by a mocked database. Queries are
+// matched in any order, so tests only stub the rows and check the response.
+func newTestConfig(t *testing.T) (*apiConfig, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.MatchExpectationsInOrder(false)
+	t.Cleanup(func() { db.Close() })
+
+	jwtKeys := auth.NewKeySet()
+	jwtKeys.SetHMACSecret("secret")
+	return &apiConfig{db: db, queries: database.New(db), jwtKeys: jwtKeys}, mock
+}
+
+// queryName matches a sqlc query by the name in its leading comment.
+func queryName(name string) string {
+	return "-- name: " + name + " :"
+}
+
+// mockRows builds a result set, turning values such as uuids and nullable
+// columns into what a driver would return for them.
+func mockRows(columns []string, rows ...[]any) *sqlmock.Rows {
+	result := sqlmock.NewRows(columns)
+	for _, row := range rows {
+		values := make([]driver.Value, len(row))
+		for i, v := range row {
+			if valuer, ok := v.(driver.Valuer); ok {
+				v, _ = valuer.Value()
+			}
+			values[i] = v
+		}
+		result.AddRow(values...)
+	}
+	return result
+}
+
+var chirpColumns = []string{"id", "created_at", "updated_at", "body", "user_id", "edited_at", "in_reply_to_id", "publish_at"}
+
+func chirpRows(chirps ...database.Chirp) *sqlmock.Rows {
+	rows := make([][]any, len(chirps))
+	for i, c := range chirps {
+		rows[i] = []any{c.ID, c.CreatedAt, c.UpdatedAt, c.Body, c.UserID, c.EditedAt, c.InReplyToID, c.PublishAt}
+	}
+	return mockRows(chirpColumns, rows...)
+}
+
+var userColumns = []string{
+	"id", "created_at", "updated_at", "email", "hashed_password", "email_verified_at",
+	"totp_secret", "totp_enabled_at", "totp_last_step", "delete_after", "role", "chirpy_red_until",
+}
+
+func userRows(u database.User) *sqlmock.Rows {
+	return mockRows(userColumns, []any{
+		u.ID, u.CreatedAt, u.UpdatedAt, u.Email, u.HashedPassword, u.EmailVerifiedAt,
+		u.TotpSecret, u.TotpEnabledAt, u.TotpLastStep, u.DeleteAfter, u.Role, u.ChirpyRedUntil,
+	})
+}
+
+// withPrincipal signs in the request as p, the way middlewareAuth would.
+func withPrincipal(r *http.Request, p auth.Principal) *http.Request {
+	return r.WithContext(auth.ContextWithPrincipal(r.Context(), p))
+}
+
+var apiKeyColumns = []string{"id", "created_at", "user_id", "name", "key_hash", "hint", "scopes", "last_used_at", "revoked_at"}
+
+func TestMiddlewareAuthAPIKey(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(204) }
+
+	tests := []struct {
+		name        string
+		deleteAfter sql.NullTime
+		expected    int
+	}{
+		{"owner active", sql.NullTime{}, 204},
+		{"owner deleting their account", sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true}, 401},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, mock := newTestConfig(t)
+			now := time.Now().UTC()
+			user := database.User{
+				ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Email: "bot@example.com",
+				Role: auth.RoleUser, DeleteAfter: test.deleteAfter,
+			}
+
+			mock.ExpectQuery(queryName("GetAPIKeyByHash")).WillReturnRows(mockRows(apiKeyColumns, []any{
+				uuid.New(), now, user.ID, "bot", auth.HashToken("key"), "key", auth.ScopeChirpsWrite, nil, nil,
+			}))
+			mock.ExpectQuery(queryName("GetUserById")).WillReturnRows(userRows(user))
+			mock.ExpectExec(queryName("TouchAPIKey")).WillReturnResult(sqlmock.NewResult(0, 1))
+
+			r := httptest.NewRequest("POST", "/api/chirps", nil)
+			r.Header.Set("Authorization", "ApiKey key")
+			w := httptest.NewRecorder()
+			cfg.middlewareAuth(ok, auth.ScopeChirpsWrite).ServeHTTP(w, r)
+
+			if w.Code != test.expected {
+				t.Errorf("got %d, expected %d: %s", w.Code, test.expected, w.Body)
+			}
+		})
+	}
+}
+
+func TestDeleteChirpRoles(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal auth.Principal
+		expected  int
+	}{
+		{
+			name:      "moderator",
+			principal: auth.Principal{Role: auth.RoleModerator, Scopes: auth.DefaultScopes},
+			expected:  204,
+		},
+		{
+			name:      "app acting for a moderator",
+			principal: auth.Principal{Role: auth.RoleModerator, Scopes: auth.DelegableScopes, ClientID: uuid.NewString()},
+			expected:  403,
+		},
+		{
+			name:      "user",
+			principal: auth.Principal{Role: auth.RoleUser, Scopes: auth.DefaultScopes},
+			expected:  403,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, mock := newTestConfig(t)
+			now := time.Now().UTC()
+			chirp := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: "hi", UserID: uuid.New(), PublishAt: now}
+
+			test.principal.UserID = uuid.New()
+			token, err := cfg.jwtKeys.MakeJWT(test.principal, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			mock.ExpectQuery(queryName("GetChirpById")).WillReturnRows(chirpRows(chirp))
+			if test.expected == 204 {
+				mock.ExpectExec(queryName("DeleteChirpById")).WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			r := httptest.NewRequest("DELETE", "/api/chirps/"+chirp.ID.String(), nil)
+			r.SetPathValue("chirpId", chirp.ID.String())
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			cfg.middlewareAuth(cfg.deleteChirpHandler, auth.ScopeChirpsWrite).ServeHTTP(w, r)
+
+			if w.Code != test.expected {
+				t.Errorf("got %d, expected %d: %s", w.Code, test.expected, w.Body)
+			}
+		})
+	}
+}
+
+func TestMiddlewareAuthDelegated(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(204) }
+
+	tests := []struct {
+		name     string
+		clientID string
+		scopes   []string
+		expected int
+	}{
+		{"own session on an unscoped route", "", nil, 204},
+		{"app on an unscoped route", uuid.NewString(), nil, 403},
+		{"app on a route it was granted", uuid.NewString(), []string{auth.ScopeChirpsWrite}, 204},
+		{"app on a route it was not granted", uuid.NewString(), []string{auth.ScopeUsersWrite}, 403},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, err := cfg.jwtKeys.MakeJWT(auth.Principal{
+				UserID:   uuid.New(),
+				Role:     auth.RoleUser,
+				Scopes:   auth.DelegableScopes,
+				ClientID: test.clientID,
+			}, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			cfg.middlewareAuth(ok, test.scopes...).ServeHTTP(w, r)
+
+			if w.Code != test.expected {
+				t.Errorf("got %d, expected %d: %s", w.Code, test.expected, w.Body)
+			}
+		})
+	}
+}
+
+func TestRevokeAllSessionsRevokesApps(t *testing.T) {
+	cfg, mock := newTestConfig(t)
+	userID := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(queryName("RevokeAllRefreshTokensByUser")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(queryName("RevokeAllOAuthRefreshTokensByUser")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	r := withPrincipal(httptest.NewRequest("POST", "/api/sessions/revoke-all", nil), auth.Principal{UserID: userID, Role: auth.RoleUser})
+	w := httptest.NewRecorder()
+	cfg.revokeAllSessionsHandler(w, r)
+
+	if w.Code != 204 {
+		t.Errorf("got %d, expected 204: %s", w.Code, w.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expected the app tokens to be revoked too: %v", err)
+	}
+}
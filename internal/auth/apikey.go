@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// GetAPIKey reads a key sent as "Authorization: ApiKey <key>".
+func GetAPIKey(headers http.Header) (string, error) {
+	if headers == nil {
+		return "", fmt.Errorf("no headers found")
+	}
+
+	apiKey, found := strings.CutPrefix(headers.Get("Authorization"), "ApiKey ")
+	if !found || apiKey == "" {
+		return "", fmt.Errorf("token doesn't exist")
+	}
+
+	return apiKey, nil
+}
+
+// apiKeyPrefix lets secret scanners and people recognise personal API keys.
+const apiKeyPrefix = "chirpy_"
+
+// MakeAPIKey returns a new personal API key.
+func MakeAPIKey() (string, error) {
+	token, err := MakeOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + token, nil
+}
+
+// APIKeyHint is the start of a key, for its owner to recognise it.
+func APIKeyHint(key string) string {
+	const hintLength = len(apiKeyPrefix) + 6
+	if len(key) < hintLength {
+		return key
+	}
+	return key[:hintLength]
+}
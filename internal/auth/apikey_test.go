@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGetAPIKey(t *testing.T) {
+	cases := []struct {
+		description string
+		header      string
+		expected    string
+		valid       bool
+	}{
+		{"api key", "ApiKey chirpy_abc", "chirpy_abc", true},
+		{"bearer token", "Bearer abc", "", false},
+		{"empty key", "ApiKey ", "", false},
+		{"no header", "", "", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			headers := http.Header{}
+			if c.header != "" {
+				headers.Set("Authorization", c.header)
+			}
+			got, err := GetAPIKey(headers)
+			if c.valid != (err == nil) {
+				t.Fatalf("valid = %v, got error %v", c.valid, err)
+			}
+			if got != c.expected {
+				t.Errorf("got %q, expected %q", got, c.expected)
+			}
+		})
+	}
+}
+
+func TestMakeAPIKey(t *testing.T) {
+	key, err := MakeAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, "chirpy_") || len(key) != len("chirpy_")+64 {
+		t.Errorf("unexpected key %q", key)
+	}
+	if hint := APIKeyHint(key); hint != key[:13] {
+		t.Errorf("unexpected hint %q", hint)
+	}
+
+	other, err := MakeAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key == other {
+		t.Error("keys should be random")
+	}
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"net/http"
@@ -12,43 +13,13 @@ import (
 	"github.com/google/uuid"
 )
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+func userClaims(userID uuid.UUID, expiresIn time.Duration) jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
 		Issuer:    "chirpy",
 		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
 		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
 		Subject:   userID.String(),
-	})
-
-	return token.SignedString([]byte(tokenSecret))
-}
-
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := &jwt.RegisteredClaims{}
-	token, err := jwt.ParseWithClaims(
-		tokenString,
-		claims,
-		func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(tokenSecret), nil
-		},
-	)
-	if err != nil {
-		return uuid.Nil, err
-	}
-
-	if !token.Valid {
-		return uuid.Nil, fmt.Errorf("invalid token")
-	}
-
-	id, err := token.Claims.GetSubject()
-	if err != nil {
-		return uuid.Nil, err
 	}
-
-	return uuid.Parse(id)
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -65,8 +36,19 @@ func GetBearerToken(headers http.Header) (string, error) {
 }
 
 func MakeRefreshToken() (string, error) {
+	return MakeOpaqueToken()
+}
+
+// MakeOpaqueToken returns 32 random bytes hex encoded.
+func MakeOpaqueToken() (string, error) {
 	src := make([]byte, 32)
 	rand.Read(src)
 	token := hex.EncodeToString(src)
 	return token, nil
 }
+
+// HashToken returns the hex SHA-256 digest of an opaque token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,397 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// KeySet holds the keys that sign and verify access tokens.
+type KeySet struct {
+	signingKID string
+	signingKey crypto.Signer
+	publicKeys map[string]crypto.PublicKey
+	// hmacSecret verifies legacy HS256 tokens, and signs new ones when no
+	// asymmetric signing key is configured.
+	hmacSecret []byte
+	// hmacUntil ends the acceptance of HS256 tokens, zero meaning never
+	hmacUntil time.Time
+}
+
+// JWK is the public half of a verification key as published in the JWKS.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKey decodes an RSA, P-256 or Ed25519 key published by another
+// issuer.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent: %w", err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC key: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC key: %w", err)
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("invalid EC key")
+		}
+		// crypto/ecdh rejects points that are not on the curve
+		point := append([]byte{4}, append(x, y...)...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("invalid EC key: %w", err)
+		}
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func NewKeySet() *KeySet {
+	return &KeySet{publicKeys: map[string]crypto.PublicKey{}}
+}
+
+// LoadKeySet reads every *.pem file in dir as a key named after the file, and
+// signs with the private key signingKID.
+func LoadKeySet(dir, signingKID string) (*KeySet, error) {
+	if signingKID == "" {
+		return nil, fmt.Errorf("no signing key id given")
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	ks := NewKeySet()
+	for _, path := range paths {
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := readPEMKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", kid, err)
+		}
+
+		if kid == signingKID {
+			signer, ok := key.(crypto.Signer)
+			if !ok {
+				return nil, fmt.Errorf("signing key %s is not a private key", kid)
+			}
+			err = ks.SetSigningKey(kid, signer)
+		} else if signer, ok := key.(crypto.Signer); ok {
+			err = ks.AddVerificationKey(kid, signer.Public())
+		} else {
+			err = ks.AddVerificationKey(kid, key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", kid, err)
+		}
+	}
+
+	if ks.signingKey == nil {
+		return nil, fmt.Errorf("signing key %s not found in %s", signingKID, dir)
+	}
+	return ks, nil
+}
+
+func readPEMKey(path string) (any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+// SetSigningKey makes key the one used for new tokens. Its public half is
+// added to the verification keys.
+func (ks *KeySet) SetSigningKey(kid string, key crypto.Signer) error {
+	if err := ks.AddVerificationKey(kid, key.Public()); err != nil {
+		return err
+	}
+	ks.signingKID = kid
+	ks.signingKey = key
+	return nil
+}
+
+func (ks *KeySet) AddVerificationKey(kid string, key crypto.PublicKey) error {
+	switch key.(type) {
+	case *rsa.PublicKey, ed25519.PublicKey:
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+	ks.publicKeys[kid] = key
+	return nil
+}
+
+// SetHMACSecret accepts HS256 tokens signed with secret.
+func (ks *KeySet) SetHMACSecret(secret string) {
+	ks.hmacSecret = []byte(secret)
+}
+
+// RetireHMACSecret stops accepting HS256 tokens after until.
+func (ks *KeySet) RetireHMACSecret(until time.Time) {
+	ks.hmacUntil = until
+}
+
+// MakeJWT issues an access token for the principal, carrying its role and
+// limited to its scopes.
+func (ks *KeySet) MakeJWT(p Principal, expiresIn time.Duration) (string, error) {
+	scope := strings.Join(p.Scopes, " ")
+	return ks.sign(Claims{
+		Scope:            &scope,
+		Role:             p.Role,
+		TokenUse:         tokenUseAccess,
+		ClientID:         p.ClientID,
+		RegisteredClaims: userClaims(p.UserID, expiresIn),
+	})
+}
+
+// MakeMFAToken issues the two-factor challenge token, which is not an access token.
+func (ks *KeySet) MakeMFAToken(userID uuid.UUID, expiresIn time.Duration) (string, error) {
+	return ks.sign(Claims{
+		TokenUse:         tokenUseMFA,
+		RegisteredClaims: userClaims(userID, expiresIn),
+	})
+}
+
+// MakeMagicLinkToken issues the token emailed for a passwordless login.
+func (ks *KeySet) MakeMagicLinkToken(userID, linkID uuid.UUID, expiresIn time.Duration) (string, error) {
+	claims := userClaims(userID, expiresIn)
+	claims.ID = linkID.String()
+	return ks.sign(Claims{
+		TokenUse:         tokenUseMagicLink,
+		RegisteredClaims: claims,
+	})
+}
+
+func (ks *KeySet) sign(claims Claims) (string, error) {
+	if ks.signingKey == nil {
+		if len(ks.hmacSecret) == 0 {
+			return "", fmt.Errorf("no signing key configured")
+		}
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ks.hmacSecret)
+	}
+
+	method, err := signingMethodFor(ks.signingKey.Public())
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = ks.signingKID
+	return token.SignedString(ks.signingKey)
+}
+
+// ValidateJWT checks the access token signature and expiry and returns the
+// caller it was issued to.
+func (ks *KeySet) ValidateJWT(tokenString string) (Principal, error) {
+	claims, err := ks.parse(tokenString)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	// tokens from before token_use existed are access tokens
+	if claims.TokenUse != "" && claims.TokenUse != tokenUseAccess {
+		return Principal{}, fmt.Errorf("not an access token")
+	}
+
+	return principalFromClaims(claims)
+}
+
+// ValidateMFAToken checks a token from MakeMFAToken and returns the user
+// who passed the first factor.
+func (ks *KeySet) ValidateMFAToken(tokenString string) (uuid.UUID, error) {
+	claims, err := ks.parse(tokenString)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if claims.TokenUse != tokenUseMFA {
+		return uuid.Nil, fmt.Errorf("not an mfa token")
+	}
+
+	return uuid.Parse(claims.Subject)
+}
+
+// ValidateMagicLinkToken checks a token from MakeMagicLinkToken and returns
+// the user it logs in and the id of the link.
+func (ks *KeySet) ValidateMagicLinkToken(tokenString string) (uuid.UUID, uuid.UUID, error) {
+	claims, err := ks.parse(tokenString)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	if claims.TokenUse != tokenUseMagicLink {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("not a magic link token")
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	linkID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	return userID, linkID, nil
+}
+
+func (ks *KeySet) parse(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, ks.keyFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	return claims, nil
+}
+
+// keyFunc picks the key named by the kid header if it matches the algorithm.
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || len(ks.hmacSecret) == 0 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		if !ks.hmacUntil.IsZero() && time.Now().After(ks.hmacUntil) {
+			return nil, fmt.Errorf("HS256 tokens are no longer accepted")
+		}
+		return ks.hmacSecret, nil
+	}
+
+	key, ok := ks.publicKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id: %s", kid)
+	}
+	method, err := signingMethodFor(key)
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key, nil
+}
+
+func signingMethodFor(key crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+// JWKS returns the public verification keys, sorted by kid.
+func (ks *KeySet) JWKS() JWKS {
+	kids := make([]string, 0, len(ks.publicKeys))
+	for kid := range ks.publicKeys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	jwks := JWKS{Keys: make([]JWK, 0, len(kids))}
+	for _, kid := range kids {
+		switch key := ks.publicKeys[kid].(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				Alg: jwt.SigningMethodRS256.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				Kty: "OKP",
+				Kid: kid,
+				Use: "sig",
+				Alg: jwt.SigningMethodEdDSA.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(key),
+			})
+		}
+	}
+	return jwks
+}
@@ -0,0 +1,276 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestKeySetSignAndValidate(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		description string
+		kid         string
+		key         crypto.Signer
+	}{
+		{"ed25519 key", "ed", edKey},
+		{"rsa key", "rsa", rsaKey},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			ks := NewKeySet()
+			if err := ks.SetSigningKey(c.kid, c.key); err != nil {
+				t.Fatal(err)
+			}
+
+			id := uuid.New()
+			token, err := ks.MakeJWT(Principal{UserID: id, Scopes: DefaultScopes}, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ks.ValidateJWT(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.UserID != id {
+				t.Errorf("got %v, expected %v", got.UserID, id)
+			}
+		})
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	_, oldKey, _ := ed25519.GenerateKey(rand.Reader)
+	_, newKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	before := NewKeySet()
+	before.SetSigningKey("old", oldKey)
+	id := uuid.New()
+	token, err := before.MakeJWT(Principal{UserID: id, Scopes: DefaultScopes}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// after rotation the old key only verifies
+	after := NewKeySet()
+	after.SetSigningKey("new", newKey)
+	after.AddVerificationKey("old", oldKey.Public())
+	if got, err := after.ValidateJWT(token); err != nil || got.UserID != id {
+		t.Errorf("token signed by the old key should still validate, err: %v", err)
+	}
+
+	// once the old key is dropped its tokens are rejected
+	dropped := NewKeySet()
+	dropped.SetSigningKey("new", newKey)
+	if _, err := dropped.ValidateJWT(token); err == nil {
+		t.Errorf("token signed by a removed key should not validate")
+	}
+}
+
+// makeLegacyJWT signs a token the way they were issued before key sets, with
+// a shared secret and no scope or role claims.
+func makeLegacyJWT(userID uuid.UUID, secret string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, userClaims(userID, time.Minute))
+	return token.SignedString([]byte(secret))
+}
+
+func TestKeySetLegacyHMAC(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	ks := NewKeySet()
+	ks.SetSigningKey("ed", edKey)
+	ks.SetHMACSecret("secret")
+
+	id := uuid.New()
+	legacy, err := makeLegacyJWT(id, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ks.ValidateJWT(legacy); err != nil || got.UserID != id {
+		t.Errorf("legacy HS256 token should validate, err: %v", err)
+	}
+
+	forged, err := makeLegacyJWT(id, "nosecret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.ValidateJWT(forged); err == nil {
+		t.Errorf("HS256 token with the wrong secret should not validate")
+	}
+
+	ks.RetireHMACSecret(time.Now().Add(time.Minute))
+	if _, err := ks.ValidateJWT(legacy); err != nil {
+		t.Errorf("legacy HS256 token should validate until the cutoff, err: %v", err)
+	}
+	ks.RetireHMACSecret(time.Now().Add(-time.Minute))
+	if _, err := ks.ValidateJWT(legacy); err == nil {
+		t.Errorf("legacy HS256 token should not validate after the cutoff")
+	}
+}
+
+func TestLoadKeySet(t *testing.T) {
+	dir := t.TempDir()
+	_, signing, _ := ed25519.GenerateKey(rand.Reader)
+	retired, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	der, err := x509.MarshalPKCS8PrivateKey(signing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(dir, "current.pem"), "PRIVATE KEY", der)
+
+	der, err = x509.MarshalPKIXPublicKey(retired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(dir, "retired.pem"), "PUBLIC KEY", der)
+
+	if _, err := LoadKeySet(dir, "retired"); err == nil {
+		t.Errorf("a public key should not be usable for signing")
+	}
+
+	ks, err := LoadKeySet(dir, "current")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := ks.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kid != "current" || jwks.Keys[1].Kid != "retired" {
+		t.Errorf("unexpected jwks: %+v", jwks)
+	}
+}
+
+func TestJWKPublicKey(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks := NewKeySet()
+	ks.AddVerificationKey("ed", edKey.Public())
+	ks.AddVerificationKey("rsa", rsaKey.Public())
+	for _, jwk := range ks.JWKS().Keys {
+		key, err := jwk.PublicKey()
+		if err != nil {
+			t.Fatalf("%s: %v", jwk.Kid, err)
+		}
+		if !key.(interface{ Equal(crypto.PublicKey) bool }).Equal(ks.publicKeys[jwk.Kid]) {
+			t.Errorf("%s: the decoded key differs", jwk.Kid)
+		}
+	}
+
+	ecJWK := JWK{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(ecKey.X.FillBytes(make([]byte, 32))),
+		Y:   base64.RawURLEncoding.EncodeToString(ecKey.Y.FillBytes(make([]byte, 32))),
+	}
+	key, err := ecJWK.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ecKey.PublicKey.Equal(key) {
+		t.Error("the decoded EC key differs")
+	}
+
+	ecJWK.Y = ecJWK.X
+	if _, err := ecJWK.PublicKey(); err == nil {
+		t.Error("a point off the curve should be rejected")
+	}
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMFATokenIsNotAnAccessToken(t *testing.T) {
+	ks := NewKeySet()
+	ks.SetHMACSecret("secret")
+	id := uuid.New()
+
+	mfaToken, err := ks.MakeMFAToken(id, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.ValidateJWT(mfaToken); err == nil {
+		t.Errorf("mfa token should not validate as an access token")
+	}
+	if got, err := ks.ValidateMFAToken(mfaToken); err != nil || got != id {
+		t.Errorf("mfa token should validate, err: %v", err)
+	}
+
+	accessToken, err := ks.MakeJWT(Principal{UserID: id, Scopes: DefaultScopes}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.ValidateMFAToken(accessToken); err == nil {
+		t.Errorf("access token should not validate as an mfa token")
+	}
+}
+
+func TestMagicLinkToken(t *testing.T) {
+	ks := NewKeySet()
+	ks.SetHMACSecret("secret")
+	id := uuid.New()
+	linkID := uuid.New()
+
+	token, err := ks.MakeMagicLinkToken(id, linkID, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.ValidateJWT(token); err == nil {
+		t.Errorf("magic link token should not validate as an access token")
+	}
+	if _, err := ks.ValidateMFAToken(token); err == nil {
+		t.Errorf("magic link token should not validate as an mfa token")
+	}
+	gotUser, gotLink, err := ks.ValidateMagicLinkToken(token)
+	if err != nil || gotUser != id || gotLink != linkID {
+		t.Errorf("magic link token should validate, got %v %v, err: %v", gotUser, gotLink, err)
+	}
+
+	expired, err := ks.MakeMagicLinkToken(id, linkID, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ks.ValidateMagicLinkToken(expired); err == nil {
+		t.Errorf("expired magic link token should not validate")
+	}
+
+	accessToken, err := ks.MakeJWT(Principal{UserID: id, Scopes: DefaultScopes}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ks.ValidateMagicLinkToken(accessToken); err == nil {
+		t.Errorf("access token should not validate as a magic link token")
+	}
+}
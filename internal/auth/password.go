@@ -1,15 +1,212 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) (string, error) {
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// PasswordAlgorithm is one way of hashing passwords into a self describing
+// PHC string such as "$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>".
+type PasswordAlgorithm interface {
+	// IDs are the PHC identifiers, between the first two '$', this
+	// algorithm can verify.
+	IDs() []string
+	Hash(password string) (string, error)
+	Verify(encoded, password string) error
+	// Current reports whether encoded was made with exactly the parameters
+	// this algorithm hashes with today.
+	Current(encoded string) bool
+}
+
+// PasswordHasher hashes with its preferred algorithm and verifies with any of them.
+type PasswordHasher struct {
+	preferred  PasswordAlgorithm
+	algorithms map[string]PasswordAlgorithm
+}
+
+func NewPasswordHasher(preferred PasswordAlgorithm, legacy ...PasswordAlgorithm) *PasswordHasher {
+	h := &PasswordHasher{
+		preferred:  preferred,
+		algorithms: map[string]PasswordAlgorithm{},
+	}
+	for _, alg := range append(legacy, preferred) {
+		for _, id := range alg.IDs() {
+			h.algorithms[id] = alg
+		}
+	}
+	return h
+}
+
+func (h *PasswordHasher) HashPassword(password string) (string, error) {
+	return h.preferred.Hash(password)
+}
+
+// CheckPassword returns ErrPasswordMismatch for a wrong password, and whether
+// the hash needs upgrading.
+func (h *PasswordHasher) CheckPassword(hash, password string) (bool, error) {
+	id := phcID(hash)
+	alg, ok := h.algorithms[id]
+	if !ok {
+		return false, fmt.Errorf("unsupported password hash %q", id)
+	}
+
+	if err := alg.Verify(hash, password); err != nil {
+		return false, err
+	}
+
+	needsRehash := alg != h.preferred || !alg.Current(hash)
+	return needsRehash, nil
+}
+
+func phcID(encoded string) string {
+	parts := strings.SplitN(encoded, "$", 3)
+	if len(parts) < 3 || parts[0] != "" {
+		return ""
+	}
+	return parts[1]
+}
+
+type Argon2idParams struct {
+	// Memory is in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Validate rejects parameters argon2.IDKey can not work with.
+func (p Argon2idParams) Validate() error {
+	switch {
+	case p.Iterations == 0:
+		return fmt.Errorf("argon2id iterations must be at least 1")
+	case p.Parallelism == 0:
+		return fmt.Errorf("argon2id parallelism must be at least 1")
+	case p.Memory < 8*uint32(p.Parallelism):
+		return fmt.Errorf("argon2id memory must be at least %d KiB for parallelism %d", 8*uint32(p.Parallelism), p.Parallelism)
+	}
+	return nil
+}
+
+// DefaultArgon2idParams follow the OWASP recommendation for argon2id.
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+type Argon2id struct {
+	Params Argon2idParams
+}
+
+func (a Argon2id) IDs() []string {
+	return []string{"argon2id"}
+}
+
+func (a Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, a.Params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Params.Iterations, a.Params.Memory, a.Params.Parallelism, a.Params.KeyLength)
+	return encodeArgon2id(a.Params, salt, key), nil
+}
+
+func (a Argon2id) Verify(encoded, password string) error {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (a Argon2id) Current(encoded string) bool {
+	params, _, _, err := decodeArgon2id(encoded)
+	return err == nil && params == a.Params
+}
+
+func encodeArgon2id(p Argon2idParams, salt, key []byte) string {
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		p.Memory,
+		p.Iterations,
+		p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func decodeArgon2id(encoded string) (Argon2idParams, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("unsupported argon2id version")
+	}
+
+	var p Argon2idParams
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil || p.Validate() != nil {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("invalid argon2id parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("invalid argon2id salt")
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+
+	return p, salt, key, nil
+}
+
+// Bcrypt verifies the hashes stored before argon2id.
+type Bcrypt struct {
+	Cost int
+}
+
+func (b Bcrypt) IDs() []string {
+	return []string{"2a", "2b", "2y"}
+}
+
+func (b Bcrypt) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
 	return string(hashed), err
 }
 
-func CheckPassword(hash, password string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+func (b Bcrypt) Verify(encoded, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
 	return err
 }
+
+func (b Bcrypt) Current(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err == nil && cost == b.Cost
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2idParams keep the tests fast; they are far too weak for real use.
+var testArgon2idParams = Argon2idParams{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func TestPasswordHasher(t *testing.T) {
+	hasher := NewPasswordHasher(Argon2id{Params: testArgon2idParams}, Bcrypt{Cost: bcrypt.MinCost})
+
+	hash, err := hasher.HashPassword("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("unexpected hash format %q", hash)
+	}
+
+	needsRehash, err := hasher.CheckPassword(hash, "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if needsRehash {
+		t.Error("fresh hash should not need a rehash")
+	}
+
+	_, err = hasher.CheckPassword(hash, "hunter3")
+	if !errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("expected ErrPasswordMismatch, got %v", err)
+	}
+}
+
+func TestPasswordHasherNeedsRehash(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weaker := testArgon2idParams
+	weaker.Iterations = 1
+	weaker.Memory = 512
+	oldArgon, err := Argon2id{Params: weaker}.Hash("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hasher := NewPasswordHasher(Argon2id{Params: testArgon2idParams}, Bcrypt{Cost: bcrypt.MinCost})
+
+	cases := []struct {
+		description string
+		hash        string
+	}{
+		{"bcrypt hash", string(legacy)},
+		{"argon2id hash with old parameters", oldArgon},
+	}
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			needsRehash, err := hasher.CheckPassword(c.hash, "hunter2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !needsRehash {
+				t.Error("expected the hash to need a rehash")
+			}
+
+			_, err = hasher.CheckPassword(c.hash, "wrong")
+			if !errors.Is(err, ErrPasswordMismatch) {
+				t.Errorf("expected ErrPasswordMismatch, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPasswordHasherRejectsUnknownHashes(t *testing.T) {
+	hasher := NewPasswordHasher(Argon2id{Params: testArgon2idParams})
+
+	for _, hash := range []string{"", "plaintext", "$argon2i$v=19$m=1,t=1,p=1$c2FsdA$aGFzaA", "$argon2id$v=19$m=x$salt$hash", "$argon2id$v=19$m=1024,t=1,p=0$c2FsdA$aGFzaA"} {
+		if _, err := hasher.CheckPassword(hash, "hunter2"); err == nil {
+			t.Errorf("expected an error for %q", hash)
+		}
+	}
+}
+
+func TestArgon2idParamsValidate(t *testing.T) {
+	tests := []struct {
+		description string
+		params      Argon2idParams
+		valid       bool
+	}{
+		{"defaults", DefaultArgon2idParams, true},
+		{"zero iterations", Argon2idParams{Memory: 1024, Iterations: 0, Parallelism: 1}, false},
+		{"zero parallelism", Argon2idParams{Memory: 1024, Iterations: 1, Parallelism: 0}, false},
+		{"too little memory", Argon2idParams{Memory: 15, Iterations: 1, Parallelism: 2}, false},
+		{"minimum memory", Argon2idParams{Memory: 16, Iterations: 1, Parallelism: 2}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			err := test.params.Validate()
+			if (err == nil) != test.valid {
+				t.Errorf("got %v, expected valid=%v", err, test.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package auth
+
+import "slices"
+
+// Roles are stored on the user and copied into access tokens.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var Roles = []string{RoleUser, RoleModerator, RoleAdmin}
+
+func ValidRole(role string) bool {
+	return slices.Contains(Roles, role)
+}
+
+// ScopesForRole are the scopes granted to a user with role logging in with
+// their own credentials.
+func ScopesForRole(role string) []string {
+	if role == RoleAdmin {
+		return append(slices.Clone(DefaultScopes), ScopeAdmin)
+	}
+	return DefaultScopes
+}
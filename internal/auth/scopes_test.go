@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestScopedTokens(t *testing.T) {
+	ks := NewKeySet()
+	ks.SetHMACSecret("secret")
+	id := uuid.New()
+
+	cases := []struct {
+		description string
+		makeToken   func() (string, error)
+		expected    []string
+	}{
+		{
+			description: "scopes are carried in the token",
+			makeToken: func() (string, error) {
+				return ks.MakeJWT(Principal{UserID: id, Scopes: []string{ScopeChirpsWrite}}, time.Minute)
+			},
+			expected: []string{ScopeChirpsWrite},
+		},
+		{
+			description: "empty scope stays empty",
+			makeToken: func() (string, error) {
+				return ks.MakeJWT(Principal{UserID: id}, time.Minute)
+			},
+			expected: []string{},
+		},
+		{
+			description: "token without scope claim gets default scopes",
+			makeToken: func() (string, error) {
+				return makeLegacyJWT(id, "secret")
+			},
+			expected: DefaultScopes,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			token, err := c.makeToken()
+			if err != nil {
+				t.Fatal(err)
+			}
+			principal, err := ks.ValidateJWT(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if principal.UserID != id || !slices.Equal(principal.Scopes, c.expected) {
+				t.Errorf("got %+v, expected scopes %v", principal, c.expected)
+			}
+		})
+	}
+}
+
+func TestHasScopes(t *testing.T) {
+	p := Principal{Scopes: []string{ScopeChirpsWrite}}
+
+	if !p.HasScopes() {
+		t.Errorf("no required scopes should always pass")
+	}
+	if !p.HasScopes(ScopeChirpsWrite) {
+		t.Errorf("expected %s to be granted", ScopeChirpsWrite)
+	}
+	if p.HasScopes(ScopeChirpsWrite, ScopeUsersWrite) {
+		t.Errorf("expected %s to be missing", ScopeUsersWrite)
+	}
+}
+
+func TestRoleClaim(t *testing.T) {
+	ks := NewKeySet()
+	ks.SetHMACSecret("secret")
+	id := uuid.New()
+
+	token, err := ks.MakeJWT(Principal{UserID: id, Role: RoleAdmin, Scopes: ScopesForRole(RoleAdmin)}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	principal, err := ks.ValidateJWT(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !principal.HasRole(RoleAdmin) || !principal.HasScopes(ScopeAdmin) {
+		t.Errorf("expected an admin with the admin scope, got %+v", principal)
+	}
+
+	legacy, err := makeLegacyJWT(id, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	principal, err = ks.ValidateJWT(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.Role != RoleUser {
+		t.Errorf("token without role claim should belong to a user, got %q", principal.Role)
+	}
+	if slices.Contains(ScopesForRole(RoleUser), ScopeAdmin) {
+		t.Errorf("users should not be granted %s", ScopeAdmin)
+	}
+}
+
+func TestClientIDClaim(t *testing.T) {
+	ks := NewKeySet()
+	ks.SetHMACSecret("secret")
+	id := uuid.New()
+
+	token, err := ks.MakeJWT(Principal{UserID: id, Role: RoleUser, Scopes: DelegableScopes, ClientID: "client-1"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	principal, err := ks.ValidateJWT(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !principal.Delegated() || principal.ClientID != "client-1" {
+		t.Errorf("expected a token delegated to client-1, got %+v", principal)
+	}
+
+	token, err = ks.MakeJWT(Principal{UserID: id, Role: RoleUser, Scopes: DefaultScopes}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	principal, err = ks.ValidateJWT(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.Delegated() {
+		t.Errorf("a login token should not be delegated, got %+v", principal)
+	}
+}
+
+func TestHasRoleDelegated(t *testing.T) {
+	p := Principal{Role: RoleModerator}
+	if !p.HasRole(RoleModerator, RoleAdmin) {
+		t.Errorf("expected a moderator, got %+v", p)
+	}
+
+	p.ClientID = "client-1"
+	if p.HasRole(RoleModerator, RoleAdmin) {
+		t.Errorf("an app acting for a moderator should not be one, got %+v", p)
+	}
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// base32 of the RFC 6238 SHA1 test key "12345678901234567890"
+const rfcTestSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, last six digits of the eight digit codes
+	tests := []struct {
+		unix     int64
+		expected string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, test := range tests {
+		got, err := TOTPCode(rfcTestSecret, TOTPStep(time.Unix(test.unix, 0)))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != test.expected {
+			t.Errorf("at %d got %s, expected %s", test.unix, got, test.expected)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, _ := TOTPCode(rfcTestSecret, TOTPStep(now))
+
+	if step, ok := ValidateTOTP(rfcTestSecret, code, now); !ok || step != TOTPStep(now) {
+		t.Errorf("current code should validate")
+	}
+	if _, ok := ValidateTOTP(rfcTestSecret, code, now.Add(30*time.Second)); !ok {
+		t.Errorf("code from the previous step should still validate")
+	}
+	if _, ok := ValidateTOTP(rfcTestSecret, code, now.Add(2*time.Minute)); ok {
+		t.Errorf("stale code should not validate")
+	}
+	if _, ok := ValidateTOTP(rfcTestSecret, "12345", now); ok {
+		t.Errorf("short code should not validate")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("unexpected code shape %q", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+	}
+
+	typed := " " + strings.ToUpper(strings.ReplaceAll(codes[0], "-", "")) + " "
+	if NormalizeRecoveryCode(typed) != NormalizeRecoveryCode(codes[0]) {
+		t.Errorf("normalized codes should match")
+	}
+}
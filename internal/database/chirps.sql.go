@@ -7,23 +7,70 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+const countChirpsByUserSince = `-- name: CountChirpsByUserSince :one
+SELECT count(*)
+FROM chirps
+WHERE user_id = $1
+    AND created_at >= $2
+`
+
+type CountChirpsByUserSinceParams struct {
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+func (q *Queries) CountChirpsByUserSince(ctx context.Context, arg CountChirpsByUserSinceParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countChirpsByUserSince, arg.UserID, arg.CreatedAt)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
-RETURNING id, created_at, updated_at, body, user_id
+INSERT INTO chirps (
+        id,
+        created_at,
+        updated_at,
+        body,
+        user_id,
+        in_reply_to_id,
+        publish_at
+    )
+VALUES (
+        gen_random_uuid(),
+        $1,
+        $1,
+        $2,
+        $3,
+        $4,
+        $5
+    )
+RETURNING id, created_at, updated_at, body, user_id, edited_at, in_reply_to_id, publish_at
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	CreatedAt   time.Time
+	Body        string
+	UserID      uuid.UUID
+	InReplyToID uuid.NullUUID
+	PublishAt   time.Time
 }
 
+// A scheduled chirp has a publish time in the future.
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.CreatedAt,
+		arg.Body,
+		arg.UserID,
+		arg.InReplyToID,
+		arg.PublishAt,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -31,6 +78,9 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.EditedAt,
+		&i.InReplyToID,
+		&i.PublishAt,
 	)
 	return i, err
 }
@@ -46,7 +96,7 @@ func (q *Queries) DeleteChirpById(ctx context.Context, id uuid.UUID) error {
 }
 
 const getChirpById = `-- name: GetChirpById :one
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, edited_at, in_reply_to_id, publish_at
 FROM chirps
 WHERE id = $1
 `
@@ -60,31 +110,151 @@ func (q *Queries) GetChirpById(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.EditedAt,
+		&i.InReplyToID,
+		&i.PublishAt,
 	)
 	return i, err
 }
 
-const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id
+const getChirpByIdForUpdate = `-- name: GetChirpByIdForUpdate :one
+SELECT id, created_at, updated_at, body, user_id, edited_at, in_reply_to_id, publish_at
 FROM chirps
-ORDER BY created_at ASC
+WHERE id = $1
+FOR UPDATE
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+func (q *Queries) GetChirpByIdForUpdate(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpByIdForUpdate, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.EditedAt,
+		&i.InReplyToID,
+		&i.PublishAt,
+	)
+	return i, err
+}
+
+const getChirpThread = `-- name: GetChirpThread :many
+WITH RECURSIVE ancestors AS (
+    SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.edited_at, chirps.in_reply_to_id, chirps.publish_at,
+        0 AS depth
+    FROM chirps
+    WHERE chirps.id = $1
+    UNION ALL
+    SELECT parent.id, parent.created_at, parent.updated_at, parent.body, parent.user_id, parent.edited_at, parent.in_reply_to_id, parent.publish_at,
+        ancestors.depth - 1
+    FROM chirps parent
+        JOIN ancestors ON parent.id = ancestors.in_reply_to_id
+    WHERE ancestors.depth > -$2::integer
+),
+descendants AS (
+    SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.edited_at, chirps.in_reply_to_id, chirps.publish_at,
+        0 AS depth
+    FROM chirps
+    WHERE chirps.id = $1
+    UNION ALL
+    SELECT reply.id, reply.created_at, reply.updated_at, reply.body, reply.user_id, reply.edited_at, reply.in_reply_to_id, reply.publish_at,
+        descendants.depth + 1
+    FROM chirps reply
+        JOIN descendants ON reply.in_reply_to_id = descendants.id
+    WHERE reply.publish_at <= $3
+        AND descendants.depth < $2::integer
+),
+replies AS (
+    SELECT id,
+        created_at,
+        updated_at,
+        body,
+        user_id,
+        edited_at,
+        in_reply_to_id,
+        publish_at,
+        depth
+    FROM descendants
+    WHERE depth > 0
+    ORDER BY depth,
+        publish_at,
+        id
+    LIMIT $4
+)
+SELECT id,
+    created_at,
+    updated_at,
+    body,
+    user_id,
+    edited_at,
+    in_reply_to_id,
+    publish_at,
+    depth
+FROM ancestors
+UNION ALL
+SELECT id,
+    created_at,
+    updated_at,
+    body,
+    user_id,
+    edited_at,
+    in_reply_to_id,
+    publish_at,
+    depth
+FROM replies
+ORDER BY depth ASC,
+    publish_at ASC,
+    id ASC
+`
+
+type GetChirpThreadParams struct {
+	ID         uuid.UUID
+	MaxDepth   int32
+	Now        time.Time
+	MaxReplies int32
+}
+
+type GetChirpThreadRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Body        string
+	UserID      uuid.UUID
+	EditedAt    sql.NullTime
+	InReplyToID uuid.NullUUID
+	PublishAt   time.Time
+	Depth       int32
+}
+
+// Walks up to the start of the chirp's thread and down through its published
+// replies, max_depth levels either way. Depth is negative for ancestors and
+// positive for replies, of which the max_replies nearest are kept.
+func (q *Queries) GetChirpThread(ctx context.Context, arg GetChirpThreadParams) ([]GetChirpThreadRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpThread,
+		arg.ID,
+		arg.MaxDepth,
+		arg.Now,
+		arg.MaxReplies,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Chirp
+	var items []GetChirpThreadRow
 	for rows.Next() {
-		var i Chirp
+		var i GetChirpThreadRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.EditedAt,
+			&i.InReplyToID,
+			&i.PublishAt,
+			&i.Depth,
 		); err != nil {
 			return nil, err
 		}
@@ -100,7 +270,7 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpsByUser = `-- name: GetChirpsByUser :many
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, edited_at, in_reply_to_id, publish_at
 FROM chirps
 WHERE user_id = $1
 ORDER BY created_at ASC
@@ -121,6 +291,138 @@ func (q *Queries) GetChirpsByUser(ctx context.Context, userID uuid.UUID) ([]Chir
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.EditedAt,
+			&i.InReplyToID,
+			&i.PublishAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpReplies = `-- name: ListChirpReplies :many
+SELECT id, created_at, updated_at, body, user_id, edited_at, in_reply_to_id, publish_at
+FROM chirps
+WHERE in_reply_to_id = $1::uuid
+    AND publish_at <= $2
+    AND (
+        $3::timestamp IS NULL
+        OR (publish_at, id) > (
+            $3::timestamp,
+            $4::uuid
+        )
+    )
+ORDER BY publish_at ASC,
+    id ASC
+LIMIT $5
+`
+
+type ListChirpRepliesParams struct {
+	ChirpID         uuid.UUID
+	Now             time.Time
+	CursorPublishAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) ListChirpReplies(ctx context.Context, arg ListChirpRepliesParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpReplies,
+		arg.ChirpID,
+		arg.Now,
+		arg.CursorPublishAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.EditedAt,
+			&i.InReplyToID,
+			&i.PublishAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsAsc = `-- name: ListChirpsAsc :many
+SELECT id, created_at, updated_at, body, user_id, edited_at, in_reply_to_id, publish_at
+FROM chirps
+WHERE publish_at <= $1
+    AND (
+        $2::uuid IS NULL
+        OR user_id = $2
+    )
+    AND (
+        $3::timestamp IS NULL
+        OR (publish_at, id) > (
+            $3::timestamp,
+            $4::uuid
+        )
+    )
+ORDER BY publish_at ASC,
+    id ASC
+LIMIT $5
+`
+
+type ListChirpsAscParams struct {
+	Now             time.Time
+	AuthorID        uuid.NullUUID
+	CursorPublishAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAsc,
+		arg.Now,
+		arg.AuthorID,
+		arg.CursorPublishAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.EditedAt,
+			&i.InReplyToID,
+			&i.PublishAt,
 		); err != nil {
 			return nil, err
 		}
@@ -134,3 +436,100 @@ func (q *Queries) GetChirpsByUser(ctx context.Context, userID uuid.UUID) ([]Chir
 	}
 	return items, nil
 }
+
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT id, created_at, updated_at, body, user_id, edited_at, in_reply_to_id, publish_at
+FROM chirps
+WHERE publish_at <= $1
+    AND (
+        $2::uuid IS NULL
+        OR user_id = $2
+    )
+    AND (
+        $3::timestamp IS NULL
+        OR (publish_at, id) < (
+            $3::timestamp,
+            $4::uuid
+        )
+    )
+ORDER BY publish_at DESC,
+    id DESC
+LIMIT $5
+`
+
+type ListChirpsDescParams struct {
+	Now             time.Time
+	AuthorID        uuid.NullUUID
+	CursorPublishAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc,
+		arg.Now,
+		arg.AuthorID,
+		arg.CursorPublishAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.EditedAt,
+			&i.InReplyToID,
+			&i.PublishAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $1,
+    updated_at = $2,
+    edited_at = $2
+WHERE id = $3
+RETURNING id, created_at, updated_at, body, user_id, edited_at, in_reply_to_id, publish_at
+`
+
+type UpdateChirpBodyParams struct {
+	Body      string
+	UpdatedAt time.Time
+	ID        uuid.UUID
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.Body, arg.UpdatedAt, arg.ID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.EditedAt,
+		&i.InReplyToID,
+		&i.PublishAt,
+	)
+	return i, err
+}
@@ -7,92 +7,232 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-const getRefreshToken = `-- name: GetRefreshToken :one
-SELECT token, created_at, updated_at, user_id, expires_at, revoked_at
-FROM refresh_tokens
-WHERE user_id = $1
+const consumeRefreshToken = `-- name: ConsumeRefreshToken :one
+UPDATE refresh_tokens
+SET used_at = NOW(),
+    updated_at = NOW()
+WHERE token_hash = $1
+    AND used_at IS NULL
+    AND revoked_at IS NULL
+    AND expires_at > $2
+RETURNING token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, parent_token_hash, used_at, user_agent, ip_address
 `
 
-func (q *Queries) GetRefreshToken(ctx context.Context, userID uuid.UUID) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, getRefreshToken, userID)
+type ConsumeRefreshTokenParams struct {
+	TokenHash string
+	Now       time.Time
+}
+
+func (q *Queries) ConsumeRefreshToken(ctx context.Context, arg ConsumeRefreshTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, consumeRefreshToken, arg.TokenHash, arg.Now)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.ParentTokenHash,
+		&i.UsedAt,
+		&i.UserAgent,
+		&i.IpAddress,
 	)
 	return i, err
 }
 
+const getRefreshTokensByUser = `-- name: GetRefreshTokensByUser :many
+SELECT active.family_id,
+    root.created_at,
+    active.created_at AS last_used_at,
+    active.expires_at,
+    active.user_agent,
+    active.ip_address
+FROM refresh_tokens active
+    JOIN refresh_tokens root ON root.family_id = active.family_id
+    AND root.parent_token_hash IS NULL
+WHERE active.user_id = $1
+    AND active.used_at IS NULL
+    AND active.revoked_at IS NULL
+    AND active.expires_at > $2
+ORDER BY active.created_at DESC
+`
+
+type GetRefreshTokensByUserParams struct {
+	UserID uuid.UUID
+	Now    time.Time
+}
+
+type GetRefreshTokensByUserRow struct {
+	FamilyID   uuid.UUID
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	UserAgent  string
+	IpAddress  string
+}
+
+// Lists one row per live session: the unused token at the head of each
+// family, joined with the family's first token for the login time.
+func (q *Queries) GetRefreshTokensByUser(ctx context.Context, arg GetRefreshTokensByUserParams) ([]GetRefreshTokensByUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getRefreshTokensByUser, arg.UserID, arg.Now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRefreshTokensByUserRow
+	for rows.Next() {
+		var i GetRefreshTokensByUserRow
+		if err := rows.Scan(
+			&i.FamilyID,
+			&i.CreatedAt,
+			&i.LastUsedAt,
+			&i.ExpiresAt,
+			&i.UserAgent,
+			&i.IpAddress,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserFromRefreshTokens = `-- name: GetUserFromRefreshTokens :one
-SELECT token, created_at, updated_at, user_id, expires_at, revoked_at
+SELECT token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, parent_token_hash, used_at, user_agent, ip_address
 FROM refresh_tokens
-WHERE token = $1
+WHERE token_hash = $1
 `
 
-func (q *Queries) GetUserFromRefreshTokens(ctx context.Context, token string) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, getUserFromRefreshTokens, token)
+func (q *Queries) GetUserFromRefreshTokens(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getUserFromRefreshTokens, tokenHash)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.ParentTokenHash,
+		&i.UsedAt,
+		&i.UserAgent,
+		&i.IpAddress,
 	)
 	return i, err
 }
 
+const revokeAllRefreshTokensByUser = `-- name: RevokeAllRefreshTokensByUser :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(),
+    updated_at = NOW()
+WHERE user_id = $1
+    AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeAllRefreshTokensByUser(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeAllRefreshTokensByUser, userID)
+	return err
+}
+
 const revokeRefreshToken = `-- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW(),
     updated_at = NOW()
-WHERE token = $1
+WHERE token_hash = $1
 `
 
-func (q *Queries) RevokeRefreshToken(ctx context.Context, token string) error {
-	_, err := q.db.ExecContext(ctx, revokeRefreshToken, token)
+func (q *Queries) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshToken, tokenHash)
 	return err
 }
 
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(),
+    updated_at = NOW()
+WHERE family_id = $1
+    AND user_id = $2
+    AND revoked_at IS NULL
+`
+
+type RevokeRefreshTokenFamilyParams struct {
+	FamilyID uuid.UUID
+	UserID   uuid.UUID
+}
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, arg RevokeRefreshTokenFamilyParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeRefreshTokenFamily, arg.FamilyID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const saveRefreshToken = `-- name: SaveRefreshToken :one
 INSERT INTO refresh_tokens (
-        token,
+        token_hash,
         created_at,
         updated_at,
         user_id,
         expires_at,
-        revoked_at
+        revoked_at,
+        family_id,
+        parent_token_hash,
+        user_agent,
+        ip_address
     )
-VALUES ($1, NOW(), NOW(), $2, $3, NULL)
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+VALUES ($1, NOW(), NOW(), $2, $3, NULL, $4, $5, $6, $7)
+RETURNING token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, parent_token_hash, used_at, user_agent, ip_address
 `
 
 type SaveRefreshTokenParams struct {
-	Token     string
-	UserID    uuid.UUID
-	ExpiresAt time.Time
+	TokenHash       string
+	UserID          uuid.UUID
+	ExpiresAt       time.Time
+	FamilyID        uuid.UUID
+	ParentTokenHash sql.NullString
+	UserAgent       string
+	IpAddress       string
 }
 
 func (q *Queries) SaveRefreshToken(ctx context.Context, arg SaveRefreshTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, saveRefreshToken, arg.Token, arg.UserID, arg.ExpiresAt)
+	row := q.db.QueryRowContext(ctx, saveRefreshToken,
+		arg.TokenHash,
+		arg.UserID,
+		arg.ExpiresAt,
+		arg.FamilyID,
+		arg.ParentTokenHash,
+		arg.UserAgent,
+		arg.IpAddress,
+	)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.ParentTokenHash,
+		&i.UsedAt,
+		&i.UserAgent,
+		&i.IpAddress,
 	)
 	return i, err
 }
@@ -7,10 +7,37 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
+const cancelUserDeletion = `-- name: CancelUserDeletion :exec
+UPDATE users
+SET delete_after = NULL,
+    updated_at = NOW()
+WHERE id = $1
+    AND delete_after IS NOT NULL
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, cancelUserDeletion, id)
+	return err
+}
+
+const countUsersByRole = `-- name: CountUsersByRole :one
+SELECT count(*)
+FROM users
+WHERE role = $1
+`
+
+func (q *Queries) CountUsersByRole(ctx context.Context, role string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUsersByRole, role)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (
         id,
@@ -20,7 +47,7 @@ INSERT INTO users (
         hashed_password
     )
 VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, delete_after, role, chirpy_red_until
 `
 
 type CreateUserParams struct {
@@ -37,13 +64,94 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.DeleteAfter,
+		&i.Role,
+		&i.ChirpyRedUntil,
+	)
+	return i, err
+}
+
+const deleteUserById = `-- name: DeleteUserById :exec
+DELETE FROM users
+WHERE id = $1
+`
+
+func (q *Queries) DeleteUserById(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteUserById, id)
+	return err
+}
+
+const deleteUsersDueForDeletion = `-- name: DeleteUsersDueForDeletion :many
+DELETE FROM users
+WHERE delete_after <= $1
+RETURNING email
+`
+
+// Hard deletes accounts whose grace period is over. Everything the user
+// owns cascades.
+func (q *Queries) DeleteUsersDueForDeletion(ctx context.Context, deleteAfter sql.NullTime) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, deleteUsersDueForDeletion, deleteAfter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		items = append(items, email)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const enableTOTP = `-- name: EnableTOTP :one
+UPDATE users
+SET totp_enabled_at = NOW(),
+    totp_last_step = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, delete_after, role, chirpy_red_until
+`
+
+type EnableTOTPParams struct {
+	TotpLastStep sql.NullInt64
+	ID           uuid.UUID
+}
+
+func (q *Queries) EnableTOTP(ctx context.Context, arg EnableTOTPParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, enableTOTP, arg.TotpLastStep, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.DeleteAfter,
+		&i.Role,
+		&i.ChirpyRedUntil,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SELECT id, created_at, updated_at, email, hashed_password, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, delete_after, role, chirpy_red_until
 FROM users
 WHERE email = $1
 `
@@ -57,7 +165,100 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.DeleteAfter,
+		&i.Role,
+		&i.ChirpyRedUntil,
+	)
+	return i, err
+}
+
+const getUserById = `-- name: GetUserById :one
+SELECT id, created_at, updated_at, email, hashed_password, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, delete_after, role, chirpy_red_until
+FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserById(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserById, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.DeleteAfter,
+		&i.Role,
+		&i.ChirpyRedUntil,
+	)
+	return i, err
+}
+
+const getUserByIdForUpdate = `-- name: GetUserByIdForUpdate :one
+SELECT id, created_at, updated_at, email, hashed_password, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, delete_after, role, chirpy_red_until
+FROM users
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetUserByIdForUpdate(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByIdForUpdate, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.DeleteAfter,
+		&i.Role,
+		&i.ChirpyRedUntil,
+	)
+	return i, err
+}
+
+const markEmailVerified = `-- name: MarkEmailVerified :one
+UPDATE users
+SET email_verified_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1
+    AND email = $2
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, delete_after, role, chirpy_red_until
+`
+
+type MarkEmailVerifiedParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) MarkEmailVerified(ctx context.Context, arg MarkEmailVerifiedParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, markEmailVerified, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.DeleteAfter,
+		&i.Role,
+		&i.ChirpyRedUntil,
 	)
 	return i, err
 }
@@ -71,23 +272,54 @@ func (q *Queries) ResetUser(ctx context.Context) error {
 	return err
 }
 
-const updateEmailAndPassword = `-- name: UpdateEmailAndPassword :one
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :one
 UPDATE users
-SET email = $1,
-    hashed_password = $2,
+SET delete_after = $1,
     updated_at = NOW()
-WHERE id = $3
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, delete_after, role, chirpy_red_until
 `
 
-type UpdateEmailAndPasswordParams struct {
-	Email          string
-	HashedPassword string
+type ScheduleUserDeletionParams struct {
+	DeleteAfter sql.NullTime
+	ID          uuid.UUID
+}
+
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, scheduleUserDeletion, arg.DeleteAfter, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.DeleteAfter,
+		&i.Role,
+		&i.ChirpyRedUntil,
+	)
+	return i, err
+}
+
+const setChirpyRedUntil = `-- name: SetChirpyRedUntil :one
+UPDATE users
+SET chirpy_red_until = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, delete_after, role, chirpy_red_until
+`
+
+type SetChirpyRedUntilParams struct {
+	ChirpyRedUntil sql.NullTime
 	ID             uuid.UUID
 }
 
-func (q *Queries) UpdateEmailAndPassword(ctx context.Context, arg UpdateEmailAndPasswordParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateEmailAndPassword, arg.Email, arg.HashedPassword, arg.ID)
+func (q *Queries) SetChirpyRedUntil(ctx context.Context, arg SetChirpyRedUntilParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setChirpyRedUntil, arg.ChirpyRedUntil, arg.ID)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -95,20 +327,103 @@ func (q *Queries) UpdateEmailAndPassword(ctx context.Context, arg UpdateEmailAnd
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.DeleteAfter,
+		&i.Role,
+		&i.ChirpyRedUntil,
 	)
 	return i, err
 }
 
-const upgradeUserById = `-- name: UpgradeUserById :one
+const setTOTPSecret = `-- name: SetTOTPSecret :one
 UPDATE users
-SET is_chirpy_red = TRUE
-WHERE id = $1
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SET totp_secret = $1,
+    totp_enabled_at = NULL,
+    totp_last_step = NULL,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, delete_after, role, chirpy_red_until
+`
+
+type SetTOTPSecretParams struct {
+	TotpSecret sql.NullString
+	ID         uuid.UUID
+}
+
+func (q *Queries) SetTOTPSecret(ctx context.Context, arg SetTOTPSecretParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setTOTPSecret, arg.TotpSecret, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.DeleteAfter,
+		&i.Role,
+		&i.ChirpyRedUntil,
+	)
+	return i, err
+}
+
+const setUserRole = `-- name: SetUserRole :one
+UPDATE users
+SET role = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, delete_after, role, chirpy_red_until
+`
+
+type SetUserRoleParams struct {
+	Role string
+	ID   uuid.UUID
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserRole, arg.Role, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.DeleteAfter,
+		&i.Role,
+		&i.ChirpyRedUntil,
+	)
+	return i, err
+}
+
+const updateEmail = `-- name: UpdateEmail :one
+UPDATE users
+SET email_verified_at = CASE
+        WHEN email = $1 THEN email_verified_at
+    END,
+    email = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, delete_after, role, chirpy_red_until
 `
 
-func (q *Queries) UpgradeUserById(ctx context.Context, id uuid.UUID) (User, error) {
-	row := q.db.QueryRowContext(ctx, upgradeUserById, id)
+type UpdateEmailParams struct {
+	Email string
+	ID    uuid.UUID
+}
+
+func (q *Queries) UpdateEmail(ctx context.Context, arg UpdateEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateEmail, arg.Email, arg.ID)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -116,7 +431,71 @@ func (q *Queries) UpgradeUserById(ctx context.Context, id uuid.UUID) (User, erro
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.DeleteAfter,
+		&i.Role,
+		&i.ChirpyRedUntil,
 	)
 	return i, err
 }
+
+const updatePassword = `-- name: UpdatePassword :one
+UPDATE users
+SET hashed_password = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, delete_after, role, chirpy_red_until
+`
+
+type UpdatePasswordParams struct {
+	HashedPassword string
+	ID             uuid.UUID
+}
+
+func (q *Queries) UpdatePassword(ctx context.Context, arg UpdatePasswordParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updatePassword, arg.HashedPassword, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.DeleteAfter,
+		&i.Role,
+		&i.ChirpyRedUntil,
+	)
+	return i, err
+}
+
+const useTOTPStep = `-- name: UseTOTPStep :execrows
+UPDATE users
+SET totp_last_step = $1
+WHERE id = $2
+    AND (
+        totp_last_step IS NULL
+        OR totp_last_step < $1
+    )
+`
+
+type UseTOTPStepParams struct {
+	TotpLastStep sql.NullInt64
+	ID           uuid.UUID
+}
+
+// Records the step of an accepted code. Affects no rows when that step or a
+// later one was already used, which means the code is being replayed.
+func (q *Queries) UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useTOTPStep, arg.TotpLastStep, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
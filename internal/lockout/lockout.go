@@ -0,0 +1,94 @@
+// Package lockout locks a key out for a growing time after repeated failures.
+package lockout
+
+import (
+	"context"
+	"time"
+)
+
+// Attempt is the failure record of a single key.
+type Attempt struct {
+	Failures int
+	// LockedUntil is zero when the key is not locked.
+	LockedUntil time.Time
+}
+
+// Store keeps failure records.
+type Store interface {
+	// Get returns the record for key, or a zero Attempt when there is none.
+	Get(ctx context.Context, key string) (Attempt, error)
+	// AddFailure counts a failure at now. A record whose last failure is
+	// before resetBefore is forgotten and counting starts from one again.
+	AddFailure(ctx context.Context, key string, now, resetBefore time.Time) (Attempt, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+type Policy struct {
+	// Threshold is how many failures are free before the first lockout.
+	Threshold int
+	// BaseDelay is the first lockout, doubled for every further failure.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// ResetAfter forgets failures once none happened for this long.
+	ResetAfter time.Duration
+}
+
+// Limiter applies a Policy to keys in one namespace of a Store.
+type Limiter struct {
+	store  Store
+	prefix string
+	policy Policy
+	now    func() time.Time
+}
+
+func NewLimiter(store Store, prefix string, policy Policy) *Limiter {
+	return &Limiter{
+		store:  store,
+		prefix: prefix + ":",
+		policy: policy,
+		now:    time.Now,
+	}
+}
+
+// RetryAfter returns how long key stays locked, or zero when it may try.
+func (l *Limiter) RetryAfter(ctx context.Context, key string) (time.Duration, error) {
+	attempt, err := l.store.Get(ctx, l.prefix+key)
+	if err != nil {
+		return 0, err
+	}
+
+	now := l.now()
+	if attempt.LockedUntil.After(now) {
+		return attempt.LockedUntil.Sub(now), nil
+	}
+	return 0, nil
+}
+
+// Fail records a failed attempt for key and locks it when the policy says
+// so.
+func (l *Limiter) Fail(ctx context.Context, key string) error {
+	now := l.now()
+	attempt, err := l.store.AddFailure(ctx, l.prefix+key, now, now.Add(-l.policy.ResetAfter))
+	if err != nil {
+		return err
+	}
+
+	if attempt.Failures < l.policy.Threshold {
+		return nil
+	}
+	return l.store.Lock(ctx, l.prefix+key, now.Add(l.delay(attempt.Failures)))
+}
+
+func (l *Limiter) delay(failures int) time.Duration {
+	delay := l.policy.BaseDelay
+	for i := l.policy.Threshold; i < failures && delay < l.policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, l.policy.MaxDelay)
+}
+
+// Reset forgets every failure of key, unlocking it.
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.store.Reset(ctx, l.prefix+key)
+}
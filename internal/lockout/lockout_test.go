@@ -0,0 +1,89 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewLimiter(NewMemoryStore(), "account", Policy{
+		Threshold:  3,
+		BaseDelay:  time.Minute,
+		MaxDelay:   3 * time.Minute,
+		ResetAfter: time.Hour,
+	})
+	l.now = func() time.Time { return now }
+
+	retryAfter := func() time.Duration {
+		t.Helper()
+		d, err := l.RetryAfter(ctx, "user@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	fail := func() {
+		t.Helper()
+		if err := l.Fail(ctx, "user@example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fail()
+	fail()
+	if d := retryAfter(); d != 0 {
+		t.Errorf("below threshold, got lock of %v", d)
+	}
+
+	fail()
+	if d := retryAfter(); d != time.Minute {
+		t.Errorf("at threshold, got %v, expected %v", d, time.Minute)
+	}
+
+	// every further failure doubles the lock, up to the maximum
+	now = now.Add(time.Minute)
+	fail()
+	if d := retryAfter(); d != 2*time.Minute {
+		t.Errorf("got %v, expected %v", d, 2*time.Minute)
+	}
+	now = now.Add(2 * time.Minute)
+	fail()
+	if d := retryAfter(); d != 3*time.Minute {
+		t.Errorf("got %v, expected the cap of %v", d, 3*time.Minute)
+	}
+
+	// other keys are unaffected
+	if d, _ := l.RetryAfter(ctx, "other@example.com"); d != 0 {
+		t.Errorf("other key should not be locked, got %v", d)
+	}
+
+	if err := l.Reset(ctx, "user@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if d := retryAfter(); d != 0 {
+		t.Errorf("after reset, got lock of %v", d)
+	}
+}
+
+func TestLimiterForgetsOldFailures(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewLimiter(NewMemoryStore(), "ip", Policy{
+		Threshold:  2,
+		BaseDelay:  time.Minute,
+		MaxDelay:   time.Hour,
+		ResetAfter: time.Hour,
+	})
+	l.now = func() time.Time { return now }
+
+	l.Fail(ctx, "10.0.0.1")
+	now = now.Add(2 * time.Hour)
+	l.Fail(ctx, "10.0.0.1")
+
+	if d, _ := l.RetryAfter(ctx, "10.0.0.1"); d != 0 {
+		t.Errorf("failures past ResetAfter should be forgotten, got lock of %v", d)
+	}
+}
@@ -0,0 +1,59 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryAttempt struct {
+	Attempt
+	updatedAt time.Time
+}
+
+// MemoryStore keeps failure records in process memory.
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]memoryAttempt
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attempts: map[string]memoryAttempt{}}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts[key].Attempt, nil
+}
+
+func (s *MemoryStore) AddFailure(ctx context.Context, key string, now, resetBefore time.Time) (Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.attempts[key]
+	if !ok || a.updatedAt.Before(resetBefore) {
+		a = memoryAttempt{}
+	}
+	a.Failures++
+	a.updatedAt = now
+	s.attempts[key] = a
+	return a.Attempt, nil
+}
+
+func (s *MemoryStore) Lock(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := s.attempts[key]
+	a.LockedUntil = until
+	s.attempts[key] = a
+	return nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
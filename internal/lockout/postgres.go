@@ -0,0 +1,60 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/babanini95/chirpy/internal/database"
+)
+
+// PostgresStore keeps failure records in the login_attempts table.
+type PostgresStore struct {
+	queries *database.Queries
+}
+
+func NewPostgresStore(queries *database.Queries) *PostgresStore {
+	return &PostgresStore{queries: queries}
+}
+
+func (s *PostgresStore) Get(ctx context.Context, key string) (Attempt, error) {
+	row, err := s.queries.GetLoginAttempt(ctx, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Attempt{}, nil
+	}
+	if err != nil {
+		return Attempt{}, err
+	}
+	return attemptFromRow(row), nil
+}
+
+func (s *PostgresStore) AddFailure(ctx context.Context, key string, now, resetBefore time.Time) (Attempt, error) {
+	row, err := s.queries.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		AttemptKey:  key,
+		Now:         now.UTC(),
+		ResetBefore: resetBefore.UTC(),
+	})
+	if err != nil {
+		return Attempt{}, err
+	}
+	return attemptFromRow(row), nil
+}
+
+func (s *PostgresStore) Lock(ctx context.Context, key string, until time.Time) error {
+	return s.queries.LockLoginAttempt(ctx, database.LockLoginAttemptParams{
+		LockedUntil: sql.NullTime{Time: until.UTC(), Valid: true},
+		AttemptKey:  key,
+	})
+}
+
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	return s.queries.DeleteLoginAttempt(ctx, key)
+}
+
+func attemptFromRow(row database.LoginAttempt) Attempt {
+	return Attempt{
+		Failures:    int(row.Failures),
+		LockedUntil: row.LockedUntil.Time,
+	}
+}
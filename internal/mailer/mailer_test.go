@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLogMailer(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewLogMailer(&buf)
+
+	err := m.Send(context.Background(), Message{
+		To:      "user@example.com",
+		Subject: "Reset your password",
+		Body:    "https://chirpy.example/reset?token=abc",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, want := range []string{"To: user@example.com", "Subject: Reset your password", "token=abc"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected %q in output:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestSMTPMailerRejectsHeaderInjection(t *testing.T) {
+	// nothing listens on the address, so only the header check can pass or
+	// fail before dialing
+	m := &SMTPMailer{Addr: "127.0.0.1:1", From: "chirpy@example.com"}
+
+	tests := []Message{
+		{To: "user@example.com\r\nBcc: victim@example.com", Subject: "Hi"},
+		{To: "user@example.com", Subject: "Hi\nBcc: victim@example.com"},
+	}
+	for _, msg := range tests {
+		err := m.Send(context.Background(), msg)
+		if err == nil || !strings.Contains(err.Error(), "line breaks") {
+			t.Errorf("expected a line break error for %q / %q, got %v", msg.To, msg.Subject, err)
+		}
+	}
+}
+
+func TestSMTPMailerHonorsContext(t *testing.T) {
+	m := &SMTPMailer{Addr: "127.0.0.1:1", From: "chirpy@example.com"}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := m.Send(ctx, Message{To: "user@example.com", Subject: "Hi"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
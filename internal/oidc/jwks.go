@@ -0,0 +1,90 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/babanini95/chirpy/internal/auth"
+)
+
+// jwksRefreshInterval limits how often an unknown kid refetches the JWKS.
+const jwksRefreshInterval = time.Minute
+
+// keyCache holds the provider's signing keys, refetched for unknown kids.
+type keyCache struct {
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+func (c *keyCache) get(ctx context.Context, client *http.Client, jwksURI, kid, alg string, now time.Time) (crypto.PublicKey, error) {
+	if !isSupportedAlgorithm(alg) {
+		return nil, fmt.Errorf("unexpected signing method: %s", alg)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key, ok := c.keys[kid]
+	if !ok && now.Sub(c.fetchedAt) >= jwksRefreshInterval {
+		keys, err := fetchJWKS(ctx, client, jwksURI)
+		if err != nil {
+			return nil, err
+		}
+		c.keys = keys
+		c.fetchedAt = now
+		key, ok = c.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key id: %s", kid)
+	}
+
+	// the key decides the algorithm, never the token
+	if algorithmFor(key) != alg {
+		return nil, fmt.Errorf("unexpected signing method: %s", alg)
+	}
+	return key, nil
+}
+
+func fetchJWKS(ctx context.Context, client *http.Client, jwksURI string) (map[string]crypto.PublicKey, error) {
+	jwks := auth.JWKS{}
+	if err := getJSON(ctx, client, jwksURI, &jwks); err != nil {
+		return nil, fmt.Errorf("fetching JWKS: %w", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			// one key Chirpy can not use must not lock out the others
+			log.Printf("skipping JWKS key %q: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func algorithmFor(key crypto.PublicKey) string {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return "RS256"
+	case *ecdsa.PublicKey:
+		return "ES256"
+	case ed25519.PublicKey:
+		return "EdDSA"
+	default:
+		return ""
+	}
+}
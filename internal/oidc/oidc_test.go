@@ -0,0 +1,365 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/babanini95/chirpy/internal/auth"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeProvider is a minimal OIDC issuer: it publishes its metadata and JWKS,
+// and hands out one ID token per authorization code it was told about.
+type fakeProvider struct {
+	*httptest.Server
+	t *testing.T
+
+	mu     sync.Mutex
+	kid    string
+	key    crypto.Signer
+	jwks   auth.JWKS
+	codes  map[string]fakeCode
+	hits   map[string]int
+	issuer string
+}
+
+type fakeCode struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	f := &fakeProvider{t: t, codes: map[string]fakeCode{}, hits: map[string]int{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		f.hit("discovery")
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 f.issuer,
+			"authorization_endpoint": f.URL + "/authorize",
+			"token_endpoint":         f.URL + "/token",
+			"jwks_uri":               f.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		f.hit("jwks")
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		json.NewEncoder(w).Encode(f.jwks)
+	})
+	mux.HandleFunc("POST /token", f.token)
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	f.issuer = f.URL
+
+	f.rotate("rsa-1", newRSAKey(t))
+	return f
+}
+
+func (f *fakeProvider) hit(endpoint string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.hits[endpoint]++
+}
+
+// rotate starts signing with key and publishes it next to the old keys.
+func (f *fakeProvider) rotate(kid string, key crypto.Signer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.kid, f.key = kid, key
+	f.jwks.Keys = append(f.jwks.Keys, toJWK(f.t, kid, key.Public()))
+}
+
+// authorize stands in for the user signing in at the provider: it returns a
+// code bound to the PKCE challenge in authURL.
+func (f *fakeProvider) authorize(authURL string, claims jwt.MapClaims) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		f.t.Fatalf("code_challenge_method = %q", q.Get("code_challenge_method"))
+	}
+	if _, ok := claims["nonce"]; !ok {
+		claims["nonce"] = q.Get("nonce")
+	}
+
+	code := "code-" + q.Get("state")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.codes[code] = fakeCode{challenge: q.Get("code_challenge"), claims: claims}
+	return code
+}
+
+func (f *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	code, ok := f.codes[r.PostForm.Get("code")]
+	delete(f.codes, r.PostForm.Get("code"))
+	if !ok || r.PostForm.Get("client_secret") != "client-secret" {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+	if !VerifyPKCE(r.PostForm.Get("code_verifier"), code.challenge) {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"id_token":     f.sign(code.claims),
+	})
+}
+
+func (f *fakeProvider) sign(claims jwt.MapClaims) string {
+	method := jwt.SigningMethod(jwt.SigningMethodRS256)
+	if _, ok := f.key.(ed25519.PrivateKey); ok {
+		method = jwt.SigningMethodEdDSA
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = f.kid
+	signed, err := token.SignedString(f.key)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return signed
+}
+
+func (f *fakeProvider) claims(now time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            f.issuer,
+		"sub":            "subject-1",
+		"aud":            "client-id",
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"email":          "walt@example.com",
+		"email_verified": true,
+	}
+}
+
+func (f *fakeProvider) provider() *Provider {
+	return NewProvider(Config{
+		Name:         "fake",
+		Issuer:       f.issuer,
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		RedirectURL:  "http://chirpy.test/api/auth/fake/callback",
+	}, f.Client())
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func toJWK(t *testing.T, kid string, key crypto.PublicKey) auth.JWK {
+	t.Helper()
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return auth.JWK{
+			Kty: "RSA", Kid: kid, Use: "sig", Alg: "RS256",
+			N: base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		return auth.JWK{Kty: "OKP", Kid: kid, Use: "sig", Alg: "EdDSA", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(key)}
+	}
+	t.Fatalf("unsupported key %T", key)
+	return auth.JWK{}
+}
+
+// login runs the whole flow the way the callback handler does.
+func login(t *testing.T, f *fakeProvider, p *Provider, claims jwt.MapClaims) (Identity, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	verifier, err := NewPKCEVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := f.authorize(authURL, claims)
+
+	idToken, err := p.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.VerifyIDToken(ctx, idToken, "nonce-1")
+}
+
+func TestLogin(t *testing.T) {
+	f := newFakeProvider(t)
+	p := f.provider()
+
+	identity, err := login(t, f, p, f.claims(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Identity{Subject: "subject-1", Email: "walt@example.com", EmailVerified: true}
+	if identity != expected {
+		t.Errorf("got %+v, expected %+v", identity, expected)
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	f := newFakeProvider(t)
+	p := f.provider()
+
+	authURL, err := p.AuthCodeURL(context.Background(), "state-1", "nonce-1", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+
+	expected := map[string]string{
+		"response_type":         "code",
+		"client_id":             "client-id",
+		"redirect_uri":          "http://chirpy.test/api/auth/fake/callback",
+		"scope":                 "openid email profile",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        PKCEChallenge("verifier"),
+		"code_challenge_method": "S256",
+	}
+	for param, value := range expected {
+		if q.Get(param) != value {
+			t.Errorf("%s = %q, expected %q", param, q.Get(param), value)
+		}
+	}
+	if !strings.HasPrefix(authURL, f.URL+"/authorize?") {
+		t.Errorf("unexpected authorization endpoint %s", authURL)
+	}
+}
+
+func TestExchangeRequiresPKCEVerifier(t *testing.T) {
+	f := newFakeProvider(t)
+	p := f.provider()
+	ctx := context.Background()
+
+	verifier, _ := NewPKCEVerifier()
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := f.authorize(authURL, f.claims(time.Now()))
+
+	other, _ := NewPKCEVerifier()
+	if _, err := p.Exchange(ctx, code, other); err == nil {
+		t.Error("expected the exchange to fail with the wrong verifier")
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	now := time.Now()
+	other := newRSAKey(t)
+
+	cases := []struct {
+		description string
+		modify      func(f *fakeProvider, claims jwt.MapClaims)
+	}{
+		{"another issuer", func(f *fakeProvider, c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"another audience", func(f *fakeProvider, c jwt.MapClaims) { c["aud"] = "other-client" }},
+		{"several audiences without azp", func(f *fakeProvider, c jwt.MapClaims) { c["aud"] = []string{"client-id", "other-client"} }},
+		{"expired", func(f *fakeProvider, c jwt.MapClaims) { c["exp"] = now.Add(-time.Hour).Unix() }},
+		{"no expiry", func(f *fakeProvider, c jwt.MapClaims) { delete(c, "exp") }},
+		{"another nonce", func(f *fakeProvider, c jwt.MapClaims) { c["nonce"] = "replayed" }},
+		{"no subject", func(f *fakeProvider, c jwt.MapClaims) { delete(c, "sub") }},
+		{"unpublished key", func(f *fakeProvider, c jwt.MapClaims) { f.key = other }},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			f := newFakeProvider(t)
+			claims := f.claims(now)
+			c.modify(f, claims)
+
+			if _, err := login(t, f, f.provider(), claims); err == nil {
+				t.Error("expected the ID token to be rejected")
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenRejectsHMAC(t *testing.T) {
+	f := newFakeProvider(t)
+	p := f.provider()
+
+	// an attacker who knows the public key must not be able to use it as an
+	// HMAC secret
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, f.claims(time.Now()))
+	token.Header["kid"] = "rsa-1"
+	signed, err := token.SignedString([]byte("rsa-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.VerifyIDToken(context.Background(), signed, "nonce-1"); err == nil {
+		t.Error("expected an HS256 ID token to be rejected")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	f := newFakeProvider(t)
+	p := f.provider()
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	if _, err := login(t, f, p, f.claims(now)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.rotate("ed-1", key)
+
+	// the new kid is only looked up once the cached keys are old enough
+	if _, err := login(t, f, p, f.claims(now)); err == nil {
+		t.Error("expected the JWKS not to be fetched again right away")
+	}
+	now = now.Add(jwksRefreshInterval)
+	if _, err := login(t, f, p, f.claims(now)); err != nil {
+		t.Fatal(err)
+	}
+	if f.hits["discovery"] != 1 || f.hits["jwks"] != 2 {
+		t.Errorf("got %v requests, expected 1 discovery and 2 JWKS", f.hits)
+	}
+}
+
+func TestDiscoveryChecksIssuer(t *testing.T) {
+	f := newFakeProvider(t)
+	p := f.provider()
+	f.issuer = "https://evil.example.com"
+
+	if _, err := p.AuthCodeURL(context.Background(), "state", "nonce", "verifier"); err == nil {
+		t.Error("expected discovery to reject a mismatched issuer")
+	}
+}
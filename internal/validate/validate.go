@@ -0,0 +1,146 @@
+// Package validate checks account details, reporting problems per field.
+package validate
+
+import (
+	"bufio"
+	"fmt"
+	"net/mail"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FieldErrors maps a request field to what is wrong with it.
+type FieldErrors map[string]string
+
+func (e FieldErrors) Add(field, message string) {
+	if _, ok := e[field]; !ok {
+		e[field] = message
+	}
+}
+
+func (e FieldErrors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	problems := make([]string, len(fields))
+	for i, field := range fields {
+		problems[i] = field + " " + e[field]
+	}
+	return strings.Join(problems, ", ")
+}
+
+// Err returns e as an error, or nil when there are no problems.
+func (e FieldErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// NormalizeEmail trims the address and lowercases its domain.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return "", fmt.Errorf("is required")
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return "", fmt.Errorf("is not a valid email address")
+	}
+
+	at := strings.LastIndex(email, "@")
+	local, domain := email[:at], strings.ToLower(email[at+1:])
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, "[") {
+		return "", fmt.Errorf("is not a valid email address")
+	}
+	return local + "@" + domain, nil
+}
+
+// PasswordPolicy are the strength rules for new passwords. The zero value
+// accepts anything but an empty password.
+type PasswordPolicy struct {
+	// MinLength and MaxLength count characters, not bytes. A MaxLength of
+	// zero means no limit.
+	MinLength int
+	MaxLength int
+	// MinCharacterClasses is how many of lowercase letters, uppercase
+	// letters, digits and symbols must appear.
+	MinCharacterClasses int
+	// Breached holds known leaked passwords, lowercased.
+	Breached map[string]struct{}
+}
+
+// DefaultPasswordPolicy follows NIST SP 800-63B.
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength: 8,
+	MaxLength: 256,
+}
+
+// Check returns why password is not acceptable, or nil.
+func (p PasswordPolicy) Check(password string) error {
+	length := utf8.RuneCountInString(password)
+	switch {
+	case length == 0:
+		return fmt.Errorf("is required")
+	case length < p.MinLength:
+		return fmt.Errorf("must be at least %d characters", p.MinLength)
+	case p.MaxLength > 0 && length > p.MaxLength:
+		return fmt.Errorf("must be at most %d characters", p.MaxLength)
+	}
+
+	if characterClasses(password) < p.MinCharacterClasses {
+		return fmt.Errorf("must mix at least %d of lowercase, uppercase, digits and symbols", p.MinCharacterClasses)
+	}
+
+	if _, ok := p.Breached[strings.ToLower(password)]; ok {
+		return fmt.Errorf("has appeared in a data breach, choose another one")
+	}
+	return nil
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// LoadBreachedPasswords reads leaked passwords, one per line.
+func LoadBreachedPasswords(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	breached := map[string]struct{}{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		password := strings.TrimRight(scanner.Text(), "\r")
+		if password == "" {
+			continue
+		}
+		breached[strings.ToLower(password)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return breached, nil
+}
@@ -0,0 +1,106 @@
+package validate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected string
+		valid    bool
+	}{
+		{"bob@example.com", "bob@example.com", true},
+		{"  Bob@Example.COM ", "Bob@example.com", true},
+		{"", "", false},
+		{"bob", "", false},
+		{"bob@localhost", "", false},
+		{"bob@@example.com", "", false},
+		{"Bob <bob@example.com>", "", false},
+		{"bob@example.com, eve@example.com", "", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			got, err := NormalizeEmail(c.input)
+			if c.valid != (err == nil) {
+				t.Fatalf("valid = %v, got error %v", c.valid, err)
+			}
+			if got != c.expected {
+				t.Errorf("got %q, expected %q", got, c.expected)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := PasswordPolicy{
+		MinLength:           8,
+		MaxLength:           16,
+		MinCharacterClasses: 2,
+		Breached:            map[string]struct{}{"password1": {}},
+	}
+
+	cases := []struct {
+		description string
+		password    string
+		valid       bool
+	}{
+		{"empty", "", false},
+		{"too short", "abc12", false},
+		{"too long", "abcdefgh12345678x", false},
+		{"one character class", "abcdefghij", false},
+		{"breached in other case", "PassWord1", false},
+		{"acceptable", "correct horse", true},
+		{"counts characters not bytes", "ééééé123", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			err := policy.Check(c.password)
+			if c.valid != (err == nil) {
+				t.Errorf("valid = %v, got error %v", c.valid, err)
+			}
+		})
+	}
+}
+
+func TestLoadBreachedPasswords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	err := os.WriteFile(path, []byte("123456\r\nPassword\n\nqwerty\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	breached, err := LoadBreachedPasswords(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(breached) != 3 {
+		t.Errorf("expected 3 passwords, got %d", len(breached))
+	}
+	for _, password := range []string{"123456", "password", "qwerty"} {
+		if _, ok := breached[password]; !ok {
+			t.Errorf("expected %q to be loaded", password)
+		}
+	}
+}
+
+func TestFieldErrors(t *testing.T) {
+	errs := FieldErrors{}
+	if errs.Err() != nil {
+		t.Fatal("expected no error without problems")
+	}
+
+	errs.Add("password", "is required")
+	errs.Add("email", "is required")
+	errs.Add("email", "is not a valid email address")
+	if errs["email"] != "is required" {
+		t.Errorf("expected the first problem to be kept, got %q", errs["email"])
+	}
+	if got := errs.Err().Error(); got != "email is required, password is required" {
+		t.Errorf("unexpected message %q", got)
+	}
+}
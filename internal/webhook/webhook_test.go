@@ -0,0 +1,71 @@
+package webhook
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{"id":"evt_1","event":"user.upgraded"}`)
+
+	v := NewVerifier("X-Timestamp", "X-Signature", 5*time.Minute, "new-secret", "old-secret")
+	v.now = func() time.Time { return now }
+
+	sign := func(secret string, at time.Time, body []byte) http.Header {
+		timestamp := strconv.FormatInt(at.Unix(), 10)
+		h := http.Header{}
+		h.Set("X-Timestamp", timestamp)
+		h.Set("X-Signature", hex.EncodeToString(Sign([]byte(secret), timestamp, body)))
+		return h
+	}
+
+	rotating := sign("retired-secret", now, body)
+	rotating.Set("X-Signature", rotating.Get("X-Signature")+", "+sign("new-secret", now, body).Get("X-Signature"))
+
+	cases := []struct {
+		description string
+		headers     http.Header
+		body        []byte
+		expected    error
+	}{
+		{"signed with the current secret", sign("new-secret", now, body), body, nil},
+		{"signed with a secret being rotated out", sign("old-secret", now, body), body, nil},
+		{"one of several signatures matches", rotating, body, nil},
+		{"slightly in the future", sign("new-secret", now.Add(time.Minute), body), body, nil},
+		{"unknown secret", sign("other-secret", now, body), body, ErrInvalidSignature},
+		{"body tampered with", sign("new-secret", now, body), []byte(`{"id":"evt_1","event":"user.downgraded"}`), ErrInvalidSignature},
+		{"too old", sign("new-secret", now.Add(-6*time.Minute), body), body, ErrExpired},
+		{"no headers", http.Header{}, body, ErrMissingSignature},
+	}
+
+	for _, c := range cases {
+		t.Run(c.description, func(t *testing.T) {
+			err := v.Verify(c.headers, c.body)
+			if !errors.Is(err, c.expected) {
+				t.Errorf("got %v, expected %v", err, c.expected)
+			}
+		})
+	}
+}
+
+func TestVerifyTimestampIsSigned(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{}`)
+	v := NewVerifier("X-Timestamp", "X-Signature", 5*time.Minute, "secret")
+	v.now = func() time.Time { return now }
+
+	// a captured delivery can not be refreshed by only changing its timestamp
+	old := strconv.FormatInt(now.Add(-time.Hour).Unix(), 10)
+	h := http.Header{}
+	h.Set("X-Timestamp", strconv.FormatInt(now.Unix(), 10))
+	h.Set("X-Signature", hex.EncodeToString(Sign([]byte("secret"), old, body)))
+
+	if err := v.Verify(h, body); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("got %v, expected %v", err, ErrInvalidSignature)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/babanini95/chirpy/internal/lockout"
+	"github.com/google/uuid"
+)
+
+var (
+	// accountLockoutPolicy protects a single account.
+	accountLockoutPolicy = lockout.Policy{
+		Threshold:  5,
+		BaseDelay:  30 * time.Second,
+		MaxDelay:   15 * time.Minute,
+		ResetAfter: 24 * time.Hour,
+	}
+	// ipLockoutPolicy stops one address from trying many accounts.
+	ipLockoutPolicy = lockout.Policy{
+		Threshold:  20,
+		BaseDelay:  30 * time.Second,
+		MaxDelay:   time.Hour,
+		ResetAfter: time.Hour,
+	}
+)
+
+// accountLockoutKey keys by email, so unknown addresses count too.
+func accountLockoutKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// checkLoginLockout answers 429 while the account or address is locked out.
+func (cfg *apiConfig) checkLoginLockout(w http.ResponseWriter, r *http.Request, email string) bool {
+	accountWait, err := cfg.accountLockout.RetryAfter(r.Context(), accountLockoutKey(email))
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return false
+	}
+	ipWait, err := cfg.ipLockout.RetryAfter(r.Context(), clientInfoFromRequest(r).IPAddress)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return false
+	}
+
+	wait := max(accountWait, ipWait)
+	if wait == 0 {
+		return true
+	}
+	respondWithRetryAfter(w, wait, "too many failed login attempts, try again later")
+	return false
+}
+
+// respondWithRetryAfter answers 429, telling the client when to come back.
+func respondWithRetryAfter(w http.ResponseWriter, wait time.Duration, msg string) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	respondWithError(w, 429, msg)
+}
+
+func (cfg *apiConfig) recordLoginFailure(r *http.Request, email string) {
+	if err := cfg.accountLockout.Fail(r.Context(), accountLockoutKey(email)); err != nil {
+		log.Printf("recording failed login: %v", err)
+	}
+	if err := cfg.ipLockout.Fail(r.Context(), clientInfoFromRequest(r).IPAddress); err != nil {
+		log.Printf("recording failed login: %v", err)
+	}
+}
+
+func (cfg *apiConfig) recordLoginSuccess(r *http.Request, email string) {
+	if err := cfg.accountLockout.Reset(r.Context(), accountLockoutKey(email)); err != nil {
+		log.Printf("resetting failed logins: %v", err)
+	}
+}
+
+func (cfg *apiConfig) unlockAccountHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	userId, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		respondWithError(w, 404, err.Error())
+		return
+	}
+
+	user, err := cfg.queries.GetUserById(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, 404, err.Error())
+		return
+	}
+
+	err = cfg.accountLockout.Reset(r.Context(), accountLockoutKey(user.Email))
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	w.WriteHeader(204)
+}
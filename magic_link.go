@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/babanini95/chirpy/internal/database"
+	"github.com/babanini95/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const magicLinkTTL = 15 * time.Minute
+
+// magicLinkHandler emails a link that logs the user in without a password.
+func (cfg *apiConfig) magicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type reqBody struct {
+		Email string `json:"email"`
+	}
+	reqData := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&reqData)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	if !cfg.checkMailLimit(w, r, "magic-link", reqData.Email) {
+		return
+	}
+
+	cfg.runInBackground(r, "sending magic link", func(ctx context.Context) error {
+		return cfg.sendMagicLink(ctx, reqData.Email)
+	})
+	w.WriteHeader(202)
+}
+
+// sendMagicLink emails a login link if email has an account.
+func (cfg *apiConfig) sendMagicLink(ctx context.Context, email string) error {
+	user, err := findUserByEmail(ctx, cfg.queries, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// the link is signed, and its id stored so it works once
+	linkId := uuid.New()
+	token, err := cfg.jwtKeys.MakeMagicLinkToken(user.ID, linkId, magicLinkTTL)
+	if err != nil {
+		return err
+	}
+	err = cfg.queries.CreateMagicLink(ctx, database.CreateMagicLinkParams{
+		ID:        linkId,
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: time.Now().UTC().Add(magicLinkTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/app/login/magic?token=%s", cfg.baseURL, url.QueryEscape(token))
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy login link",
+		Body: fmt.Sprintf(
+			"Use this link within %v to log in to Chirpy:\n%s\n\n"+
+				"It works once. If you did not ask for it, you can ignore this email.",
+			magicLinkTTL,
+			link,
+		),
+	})
+}
+
+// magicLinkLoginHandler exchanges a magic link token for a session and verifies the email.
+func (cfg *apiConfig) magicLinkLoginHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type reqBody struct {
+		Token string `json:"token"`
+	}
+	reqData := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&reqData)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	userId, linkId, err := cfg.jwtKeys.ValidateMagicLinkToken(reqData.Token)
+	if err != nil {
+		respondWithError(w, 401, "invalid or expired login link")
+		return
+	}
+
+	link, err := cfg.queries.ConsumeMagicLink(r.Context(), database.ConsumeMagicLinkParams{
+		ID:     linkId,
+		UserID: userId,
+		Now:    time.Now().UTC(),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 401, "invalid or expired login link")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	// a link sent before an email change belongs to the old address
+	user, err := cfg.queries.GetUserById(r.Context(), userId)
+	if err != nil || user.Email != link.Email {
+		respondWithError(w, 401, "invalid or expired login link")
+		return
+	}
+	if !user.EmailVerifiedAt.Valid {
+		verified, err := cfg.queries.MarkEmailVerified(r.Context(), database.MarkEmailVerifiedParams{
+			ID:    user.ID,
+			Email: user.Email,
+		})
+		if err != nil {
+			log.Printf("verifying email from magic link: %v", err)
+		} else {
+			user = verified
+		}
+	}
+
+	if user.TotpEnabledAt.Valid {
+		cfg.respondWithMFAChallenge(w, user)
+		return
+	}
+
+	cfg.recordLoginSuccess(r, user.Email)
+	cfg.respondWithLogin(w, r, user)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/babanini95/chirpy/internal/lockout"
+)
+
+var (
+	// mailPolicy keeps an inbox from being flooded with one kind of email.
+	mailPolicy = lockout.Policy{
+		Threshold:  3,
+		BaseDelay:  time.Minute,
+		MaxDelay:   time.Hour,
+		ResetAfter: time.Hour,
+	}
+	// mailIPPolicy stops one address from mailing many inboxes.
+	mailIPPolicy = lockout.Policy{
+		Threshold:  10,
+		BaseDelay:  time.Minute,
+		MaxDelay:   time.Hour,
+		ResetAfter: time.Hour,
+	}
+)
+
+// checkMailLimit counts a request for an email of kind, answering 429 when over the limit.
+func (cfg *apiConfig) checkMailLimit(w http.ResponseWriter, r *http.Request, kind, email string) bool {
+	emailKey := kind + ":" + accountLockoutKey(email)
+	ip := clientInfoFromRequest(r).IPAddress
+
+	emailWait, err := cfg.mailLimit.RetryAfter(r.Context(), emailKey)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return false
+	}
+	ipWait, err := cfg.mailIPLimit.RetryAfter(r.Context(), ip)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return false
+	}
+	if wait := max(emailWait, ipWait); wait > 0 {
+		respondWithRetryAfter(w, wait, "too many emails requested, try again later")
+		return false
+	}
+
+	if err := cfg.mailLimit.Fail(r.Context(), emailKey); err != nil {
+		log.Printf("recording email request: %v", err)
+	}
+	if err := cfg.mailIPLimit.Fail(r.Context(), ip); err != nil {
+		log.Printf("recording email request: %v", err)
+	}
+	return true
+}
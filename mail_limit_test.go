@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/babanini95/chirpy/internal/lockout"
+)
+
+func TestCheckMailLimit(t *testing.T) {
+	newConfig := func() *apiConfig {
+		store := lockout.NewMemoryStore()
+		return &apiConfig{
+			mailLimit:   lockout.NewLimiter(store, "mail", mailPolicy),
+			mailIPLimit: lockout.NewLimiter(store, "mail-ip", mailIPPolicy),
+		}
+	}
+	request := func(cfg *apiConfig, kind, email string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/", nil)
+		cfg.checkMailLimit(w, r, kind, email)
+		return w
+	}
+
+	t.Run("per email", func(t *testing.T) {
+		cfg := newConfig()
+		for range mailPolicy.Threshold {
+			if w := request(cfg, "password-reset", "Nobody@Example.com"); w.Code != 200 {
+				t.Fatalf("got %d before the threshold, expected the request to pass", w.Code)
+			}
+		}
+		w := request(cfg, "password-reset", "nobody@example.com")
+		if w.Code != 429 || w.Header().Get("Retry-After") == "" {
+			t.Errorf("got %d with Retry-After %q, expected 429", w.Code, w.Header().Get("Retry-After"))
+		}
+		if w := request(cfg, "verification", "nobody@example.com"); w.Code != 200 {
+			t.Errorf("got %d, expected other kinds of email to be counted apart", w.Code)
+		}
+	})
+
+	t.Run("per client address", func(t *testing.T) {
+		cfg := newConfig()
+		for i := range mailIPPolicy.Threshold {
+			if w := request(cfg, "password-reset", fmt.Sprintf("user%d@example.com", i)); w.Code != 200 {
+				t.Fatalf("got %d before the threshold, expected the request to pass", w.Code)
+			}
+		}
+		if w := request(cfg, "password-reset", "else@example.com"); w.Code != 429 {
+			t.Errorf("got %d, expected 429", w.Code)
+		}
+	})
+}
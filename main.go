@@ -1,37 +1,76 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
-	"sort"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/babanini95/chirpy/internal/auth"
 	"github.com/babanini95/chirpy/internal/database"
+	"github.com/babanini95/chirpy/internal/lockout"
+	"github.com/babanini95/chirpy/internal/mailer"
+	"github.com/babanini95/chirpy/internal/oidc"
+	"github.com/babanini95/chirpy/internal/validate"
+	"github.com/babanini95/chirpy/internal/webhook"
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
+	db             *sql.DB
 	queries        *database.Queries
-	polkaApiKey    string
+	polkaWebhook   *webhook.Verifier
+	jwtKeys        *auth.KeySet
+	mailer         mailer.Mailer
+	baseURL        string
+	accountLockout *lockout.Limiter
+	ipLockout      *lockout.Limiter
+	// mailLimit and mailIPLimit throttle requests that send email, per
+	// address and per client
+	mailLimit      *lockout.Limiter
+	mailIPLimit    *lockout.Limiter
+	passwords      *auth.PasswordHasher
+	passwordPolicy validate.PasswordPolicy
+	// accountDeletionGrace delays the hard delete of an account, zero
+	// deletes right away
+	accountDeletionGrace time.Duration
+	// requireVerifiedEmail blocks chirping until the author's email is verified
+	requireVerifiedEmail bool
+	// oidcProviders are the external logins offered, by name
+	oidcProviders map[string]*oidc.Provider
+	// chirpEditWindow is how long after posting a chirp can be edited, zero
+	// means forever
+	chirpEditWindow time.Duration
+	// chirpEditingRequiresRed keeps editing to plans with CanEditChirps
+	chirpEditingRequiresRed bool
+	// background tracks work that outlives the request it came from
+	background sync.WaitGroup
 }
 
 type User struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	Email        string    `json:"email"`
-	Token        string    `json:"token"`
-	RefreshToken string    `json:"refresh_token"`
-	IsChirpyRed  bool      `json:"is_chirpy_red"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	Token         string    `json:"token"`
+	RefreshToken  string    `json:"refresh_token"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	EmailVerified bool      `json:"email_verified"`
 }
 
 type authReqBody struct {
@@ -40,11 +79,32 @@ type authReqBody struct {
 }
 
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID          uuid.UUID  `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	PublishAt   time.Time  `json:"publish_at"`
+	Body        string     `json:"body"`
+	UserID      uuid.UUID  `json:"user_id"`
+	Edited      bool       `json:"edited"`
+	InReplyToID *uuid.UUID `json:"in_reply_to_id"`
+	LikeCount   int64      `json:"like_count"`
+	LikedByMe   bool       `json:"liked_by_me"`
+}
+
+func chirpFromDB(c database.Chirp) Chirp {
+	chirp := Chirp{
+		ID:        c.ID,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+		PublishAt: c.PublishAt,
+		Body:      c.Body,
+		UserID:    c.UserID,
+		Edited:    c.EditedAt.Valid,
+	}
+	if c.InReplyToID.Valid {
+		chirp.InReplyToID = &c.InReplyToID.UUID
+	}
+	return chirp
 }
 
 func main() {
@@ -63,40 +123,286 @@ func main() {
 	}
 	// get generated queries
 	dbQueries := database.New(db)
+	// one-off commands run instead of the server
+	if len(os.Args) > 1 {
+		err = runCommand(dbQueries, os.Args[1:])
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	// load jwt keys
+	jwtKeys, err := loadJWTKeys()
+	if err != nil {
+		fmt.Printf("%v", err)
+		os.Exit(1)
+	}
+	// set up outgoing mail
+	appMailer, err := loadMailer()
+	if err != nil {
+		fmt.Printf("%v", err)
+		os.Exit(1)
+	}
+	// set up password hashing
+	passwords, err := loadPasswordHasher()
+	if err != nil {
+		fmt.Printf("%v", err)
+		os.Exit(1)
+	}
+	passwordPolicy, err := loadPasswordPolicy()
+	if err != nil {
+		fmt.Printf("%v", err)
+		os.Exit(1)
+	}
+	var accountDeletionGrace time.Duration
+	if v := os.Getenv("ACCOUNT_DELETION_GRACE_PERIOD"); v != "" {
+		accountDeletionGrace, err = time.ParseDuration(v)
+		if err != nil {
+			fmt.Printf("ACCOUNT_DELETION_GRACE_PERIOD: %v", err)
+			os.Exit(1)
+		}
+	}
+	var chirpEditWindow time.Duration
+	if v := os.Getenv("CHIRP_EDIT_WINDOW"); v != "" {
+		chirpEditWindow, err = time.ParseDuration(v)
+		if err != nil {
+			fmt.Printf("CHIRP_EDIT_WINDOW: %v", err)
+			os.Exit(1)
+		}
+	}
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	// set up login with external providers
+	oidcProviders, err := loadOIDCProviders(baseURL)
+	if err != nil {
+		fmt.Printf("%v", err)
+		os.Exit(1)
+	}
 
 	mux := http.NewServeMux()
 	srv := http.Server{
 		Handler: mux,
 		Addr:    ":8080",
 	}
+	lockoutStore := lockout.NewPostgresStore(dbQueries)
+	// several comma separated secrets are accepted while rotating
+	polkaWebhook := webhook.NewVerifier(
+		polkaTimestampHeader,
+		polkaSignatureHeader,
+		polkaWebhookTolerance,
+		strings.Split(os.Getenv("POLKA_WEBHOOK_SECRETS"), ",")...,
+	)
 	// store generated queries in apiCfg
 	apiCfg := &apiConfig{
-		queries:     dbQueries,
-		polkaApiKey: os.Getenv("POLKA_KEY"),
+		db:           db,
+		queries:      dbQueries,
+		polkaWebhook: polkaWebhook,
+		jwtKeys:      jwtKeys,
+		mailer:       appMailer,
+		baseURL:      baseURL,
+
+		accountLockout: lockout.NewLimiter(lockoutStore, "account", accountLockoutPolicy),
+		ipLockout:      lockout.NewLimiter(lockoutStore, "ip", ipLockoutPolicy),
+		mailLimit:      lockout.NewLimiter(lockoutStore, "mail", mailPolicy),
+		mailIPLimit:    lockout.NewLimiter(lockoutStore, "mail-ip", mailIPPolicy),
+		passwords:      passwords,
+		passwordPolicy: passwordPolicy,
+		oidcProviders:  oidcProviders,
+
+		requireVerifiedEmail: os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true",
+		accountDeletionGrace: accountDeletionGrace,
+
+		chirpEditWindow:         chirpEditWindow,
+		chirpEditingRequiresRed: os.Getenv("CHIRP_EDITING_REQUIRES_CHIRPY_RED") == "true",
 	}
+	// run even without a grace period, for deletions scheduled before
+	go apiCfg.purgeDeletedAccounts(context.Background(), time.Hour)
+	go apiCfg.purgeExpiredOIDCLogins(context.Background(), time.Hour)
 	fileServerHandler := http.StripPrefix("/app", http.FileServer(http.Dir(".")))
 
 	mux.Handle("/app/", apiCfg.middlewareMetricsInc(fileServerHandler))
 	mux.Handle("/assets", http.FileServer(http.Dir("./assets/logo.png")))
 
 	mux.HandleFunc("GET /api/healthz", readinessHandler)
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.jwksHandler)
 	mux.HandleFunc("GET /api/chirps", apiCfg.getChirpsHandler)
 	mux.HandleFunc("GET /api/chirps/{chirpId}", apiCfg.getChirpById)
 	mux.HandleFunc("POST /api/users", apiCfg.createUserHandler)
-	mux.HandleFunc("POST /api/chirps", apiCfg.createChirpsHandler)
+	mux.HandleFunc("GET /api/users/{userId}", apiCfg.getProfileHandler)
+	mux.Handle("POST /api/chirps", apiCfg.middlewareAuth(apiCfg.createChirpsHandler, auth.ScopeChirpsWrite))
 	mux.HandleFunc("POST /api/login", apiCfg.loginHandler)
+	mux.HandleFunc("POST /api/login/2fa", apiCfg.loginSecondFactorHandler)
+	mux.HandleFunc("POST /api/login/magic", apiCfg.magicLinkHandler)
+	mux.HandleFunc("POST /api/login/magic/verify", apiCfg.magicLinkLoginHandler)
+	mux.HandleFunc("GET /api/auth/{provider}/login", apiCfg.oidcLoginHandler)
+	mux.HandleFunc("GET /api/auth/{provider}/callback", apiCfg.oidcCallbackHandler)
+	mux.Handle("POST /api/auth/{provider}/link", apiCfg.middlewareAuth(apiCfg.oidcLinkHandler, auth.ScopeUsersWrite))
 	mux.HandleFunc("POST /api/refresh", apiCfg.refreshTokenHandler)
 	mux.HandleFunc("POST /api/revoke", apiCfg.revokeAccessTokenHandler)
+	mux.HandleFunc("POST /api/users/verify", apiCfg.verifyEmailHandler)
+	mux.Handle("POST /api/users/2fa/enroll", apiCfg.middlewareAuth(apiCfg.enrollTOTPHandler, auth.ScopeUsersWrite))
+	mux.Handle("POST /api/users/2fa/confirm", apiCfg.middlewareAuth(apiCfg.confirmTOTPHandler, auth.ScopeUsersWrite))
+	mux.Handle("POST /api/users/verify/resend", apiCfg.middlewareAuth(apiCfg.resendVerificationHandler))
+	mux.HandleFunc("POST /api/password/forgot", apiCfg.forgotPasswordHandler)
+	mux.HandleFunc("POST /api/password/reset", apiCfg.resetPasswordHandler)
 	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.polkaWebhookHandler)
-	mux.HandleFunc("PUT /api/users", apiCfg.updateEmailAndPasswordHandler)
-	mux.HandleFunc("DELETE /api/chirps/{chirpId}", apiCfg.deleteChirpHandler)
-
-	mux.HandleFunc("GET /admin/metrics", apiCfg.writeNumberOfRequestHandler)
+	mux.Handle("PATCH /api/users/email", apiCfg.middlewareAuth(apiCfg.updateEmailHandler, auth.ScopeUsersWrite))
+	mux.Handle("PATCH /api/users/password", apiCfg.middlewareAuth(apiCfg.updatePasswordHandler, auth.ScopeUsersWrite))
+	mux.Handle("DELETE /api/users/me", apiCfg.middlewareAuth(apiCfg.deleteAccountHandler, auth.ScopeUsersWrite))
+	mux.Handle("GET /api/users/me/export", apiCfg.middlewareAuth(apiCfg.exportAccountHandler))
+	mux.Handle("GET /api/users/me/identities", apiCfg.middlewareAuth(apiCfg.listIdentitiesHandler))
+	mux.Handle("DELETE /api/users/me/identities/{identityId}", apiCfg.middlewareAuth(apiCfg.unlinkIdentityHandler, auth.ScopeUsersWrite))
+	mux.Handle("PUT /api/chirps/{chirpId}", apiCfg.middlewareAuth(apiCfg.updateChirpHandler, auth.ScopeChirpsWrite))
+	mux.HandleFunc("GET /api/chirps/{chirpId}/history", apiCfg.chirpHistoryHandler)
+	mux.HandleFunc("GET /api/chirps/{chirpId}/replies", apiCfg.chirpRepliesHandler)
+	mux.HandleFunc("GET /api/chirps/{chirpId}/thread", apiCfg.chirpThreadHandler)
+	mux.Handle("PUT /api/chirps/{chirpId}/like", apiCfg.middlewareAuth(apiCfg.likeChirpHandler, auth.ScopeChirpsWrite))
+	mux.Handle("DELETE /api/chirps/{chirpId}/like", apiCfg.middlewareAuth(apiCfg.unlikeChirpHandler, auth.ScopeChirpsWrite))
+	mux.HandleFunc("GET /api/chirps/{chirpId}/likes", apiCfg.chirpLikesHandler)
+	mux.Handle("DELETE /api/chirps/{chirpId}", apiCfg.middlewareAuth(apiCfg.deleteChirpHandler, auth.ScopeChirpsWrite))
+	mux.Handle("POST /api/keys", apiCfg.middlewareAuth(apiCfg.createAPIKeyHandler, auth.ScopeUsersWrite))
+	mux.Handle("GET /api/keys", apiCfg.middlewareAuth(apiCfg.listAPIKeysHandler))
+	mux.Handle("PATCH /api/keys/{keyId}", apiCfg.middlewareAuth(apiCfg.renameAPIKeyHandler, auth.ScopeUsersWrite))
+	mux.Handle("DELETE /api/keys/{keyId}", apiCfg.middlewareAuth(apiCfg.revokeAPIKeyHandler, auth.ScopeUsersWrite))
+	mux.Handle("POST /api/oauth/clients", apiCfg.middlewareAuth(apiCfg.createOAuthClientHandler, auth.ScopeUsersWrite))
+	mux.Handle("GET /api/oauth/clients", apiCfg.middlewareAuth(apiCfg.listOAuthClientsHandler))
+	mux.Handle("DELETE /api/oauth/clients/{clientId}", apiCfg.middlewareAuth(apiCfg.revokeOAuthClientHandler, auth.ScopeUsersWrite))
+	mux.Handle("GET /api/oauth/authorize", apiCfg.middlewareAuth(apiCfg.getAuthorizeHandler))
+	mux.Handle("POST /api/oauth/authorize", apiCfg.middlewareAuth(apiCfg.authorizeHandler, auth.ScopeUsersWrite))
+	mux.HandleFunc("POST /api/oauth/token", apiCfg.oauthTokenHandler)
+	mux.Handle("GET /api/oauth/consents", apiCfg.middlewareAuth(apiCfg.listOAuthConsentsHandler))
+	mux.Handle("DELETE /api/oauth/consents/{clientId}", apiCfg.middlewareAuth(apiCfg.revokeOAuthConsentHandler, auth.ScopeUsersWrite))
+	mux.Handle("GET /api/sessions", apiCfg.middlewareAuth(apiCfg.listSessionsHandler))
+	mux.Handle("DELETE /api/sessions/{sessionId}", apiCfg.middlewareAuth(apiCfg.revokeSessionHandler, auth.ScopeUsersWrite))
+	mux.Handle("POST /api/sessions/revoke-all", apiCfg.middlewareAuth(apiCfg.revokeAllSessionsHandler, auth.ScopeUsersWrite))
+
+	mux.Handle("GET /admin/metrics", apiCfg.middlewareAdmin(apiCfg.writeNumberOfRequestHandler))
 	mux.HandleFunc("POST /admin/reset", apiCfg.resetHandler)
+	mux.Handle("POST /admin/users/{userId}/unlock", apiCfg.middlewareAdmin(apiCfg.unlockAccountHandler))
+	mux.Handle("PUT /admin/users/{userId}/role", apiCfg.middlewareAdmin(apiCfg.setUserRoleHandler))
+	mux.Handle("GET /admin/polka/events", apiCfg.middlewareAdmin(apiCfg.listPolkaEventsHandler))
 
 	srv.ListenAndServe()
 }
 
+// loadJWTKeys signs with JWT_SIGNING_KID from JWT_KEYS_DIR, or SECRET_KEY.
+func loadJWTKeys() (*auth.KeySet, error) {
+	secret := os.Getenv("SECRET_KEY")
+	keysDir := os.Getenv("JWT_KEYS_DIR")
+	if keysDir == "" {
+		jwtKeys := auth.NewKeySet()
+		if secret != "" {
+			jwtKeys.SetHMACSecret(secret)
+		}
+		return jwtKeys, nil
+	}
+
+	jwtKeys, err := auth.LoadKeySet(keysDir, os.Getenv("JWT_SIGNING_KID"))
+	if err != nil {
+		return nil, err
+	}
+	if v := os.Getenv("JWT_LEGACY_HS256_UNTIL"); v != "" && secret != "" {
+		until, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_LEGACY_HS256_UNTIL: %w", err)
+		}
+		jwtKeys.SetHMACSecret(secret)
+		jwtKeys.RetireHMACSecret(until)
+	}
+	return jwtKeys, nil
+}
+
+// loadMailer delivers through SMTP_ADDR, or logs messages when it is unset.
+func loadMailer() (mailer.Mailer, error) {
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		return &mailer.SMTPMailer{
+			Addr:     addr,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		}, nil
+	}
+
+	if path := os.Getenv("MAIL_LOG_FILE"); path != "" {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		return mailer.NewLogMailer(f), nil
+	}
+	return mailer.NewLogMailer(os.Stdout), nil
+}
+
+// loadPasswordHasher hashes with argon2id, tuned by the PASSWORD_HASH_* variables.
+func loadPasswordHasher() (*auth.PasswordHasher, error) {
+	params := auth.DefaultArgon2idParams
+	if v := os.Getenv("PASSWORD_HASH_MEMORY_KIB"); v != "" {
+		memory, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("PASSWORD_HASH_MEMORY_KIB: %w", err)
+		}
+		params.Memory = uint32(memory)
+	}
+	if v := os.Getenv("PASSWORD_HASH_ITERATIONS"); v != "" {
+		iterations, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("PASSWORD_HASH_ITERATIONS: %w", err)
+		}
+		params.Iterations = uint32(iterations)
+	}
+	if v := os.Getenv("PASSWORD_HASH_PARALLELISM"); v != "" {
+		parallelism, err := strconv.ParseUint(v, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("PASSWORD_HASH_PARALLELISM: %w", err)
+		}
+		params.Parallelism = uint8(parallelism)
+	}
+	// bad parameters would otherwise only show at the first signup or login
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
+	return auth.NewPasswordHasher(
+		auth.Argon2id{Params: params},
+		auth.Bcrypt{Cost: bcrypt.DefaultCost},
+	), nil
+}
+
+// loadPasswordPolicy adjusts validate.DefaultPasswordPolicy from the environment.
+func loadPasswordPolicy() (validate.PasswordPolicy, error) {
+	policy := validate.DefaultPasswordPolicy
+	for env, field := range map[string]*int{
+		"PASSWORD_MIN_LENGTH":            &policy.MinLength,
+		"PASSWORD_MAX_LENGTH":            &policy.MaxLength,
+		"PASSWORD_MIN_CHARACTER_CLASSES": &policy.MinCharacterClasses,
+	} {
+		if v := os.Getenv(env); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return policy, fmt.Errorf("%s: %w", env, err)
+			}
+			*field = n
+		}
+	}
+
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		breached, err := validate.LoadBreachedPasswords(path)
+		if err != nil {
+			return policy, err
+		}
+		policy.Breached = breached
+	}
+	return policy, nil
+}
+
+func (cfg *apiConfig) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJson(w, 200, cfg.jwtKeys.JWKS())
+}
+
 func (cfg *apiConfig) writeNumberOfRequestHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "text/html")
 	htmlString := fmt.Sprintf(`
@@ -111,20 +417,15 @@ func (cfg *apiConfig) writeNumberOfRequestHandler(w http.ResponseWriter, r *http
 	w.WriteHeader(200)
 }
 
+// resetHandler wipes every user, only on a development platform.
 func (cfg *apiConfig) resetHandler(w http.ResponseWriter, r *http.Request) {
-	err := godotenv.Load()
-	if err != nil {
-		respondWithError(w, 500, err.Error())
-		return
-	}
-
 	isDev := os.Getenv("PLATFORM") == "dev"
 	if !isDev {
 		respondWithError(w, 403, "Forbidden")
 		return
 	}
 
-	err = cfg.queries.ResetUser(r.Context())
+	err := cfg.queries.ResetUser(r.Context())
 	if err != nil {
 		respondWithError(w, 500, err.Error())
 		return
@@ -142,6 +443,51 @@ func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	})
 }
 
+// middlewareAuth lets through callers granted every required scope.
+func (cfg *apiConfig) middlewareAuth(next http.HandlerFunc, scopes ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			respondWithError(w, 401, "token doesn't exist")
+			return
+		}
+		principal, err := cfg.authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			respondWithError(w, 401, err.Error())
+			return
+		}
+
+		if !principal.HasScopes(scopes...) {
+			w.Header().Set(
+				"WWW-Authenticate",
+				fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, strings.Join(scopes, " ")),
+			)
+			respondWithError(w, 403, "insufficient scope")
+			return
+		}
+		// apps only reach routes guarded by a scope they were granted
+		if principal.Delegated() && len(scopes) == 0 {
+			respondWithError(w, 403, "not available to third-party apps")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.ContextWithPrincipal(r.Context(), principal)))
+	})
+}
+
+// middlewareAdmin lets through admins granted the admin scope.
+func (cfg *apiConfig) middlewareAdmin(next http.HandlerFunc) http.Handler {
+	return cfg.middlewareAuth(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := auth.PrincipalFromContext(r.Context())
+		if !principal.HasRole(auth.RoleAdmin) {
+			respondWithError(w, 403, "Forbidden")
+			return
+		}
+		next.ServeHTTP(w, r)
+	}, auth.ScopeAdmin)
+}
+
 func (cfg *apiConfig) createUserHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	decoder := json.NewDecoder(r.Body)
@@ -152,7 +498,12 @@ func (cfg *apiConfig) createUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(reqData.Password)
+	if errs := cfg.validateCredentials(&reqData); len(errs) > 0 {
+		respondWithFieldErrors(w, errs)
+		return
+	}
+
+	hashedPassword, err := cfg.passwords.HashPassword(reqData.Password)
 	if err != nil {
 		respondWithError(w, 500, err.Error())
 		return
@@ -163,17 +514,27 @@ func (cfg *apiConfig) createUserHandler(w http.ResponseWriter, r *http.Request)
 		HashedPassword: hashedPassword,
 	}
 	user, err := cfg.queries.CreateUser(r.Context(), params)
+	if isUniqueViolation(err) {
+		respondWithFieldErrors(w, validate.FieldErrors{"email": "is already registered"})
+		return
+	}
 	if err != nil {
 		respondWithError(w, 500, err.Error())
 		return
 	}
 
 	jsonUser := User{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt,
-		UpdatedAt:   user.UpdatedAt,
-		Email:       user.Email,
-		IsChirpyRed: user.IsChirpyRed,
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		IsChirpyRed:   isChirpyRed(user),
+		EmailVerified: user.EmailVerifiedAt.Valid,
+	}
+
+	err = cfg.sendVerificationEmail(r.Context(), user)
+	if err != nil {
+		log.Printf("sending verification email: %v", err)
 	}
 
 	respondWithJson(w, 201, jsonUser)
@@ -182,92 +543,198 @@ func (cfg *apiConfig) createUserHandler(w http.ResponseWriter, r *http.Request)
 
 func (cfg *apiConfig) createChirpsHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
 
-	token, err := auth.GetBearerToken(r.Header)
+	type reqBody struct {
+		Body string `json:"body"`
+		// PublishAt schedules the chirp, when the author's plan allows it
+		PublishAt *time.Time `json:"publish_at"`
+		// InReplyToID makes the chirp a reply to a published chirp
+		InReplyToID *uuid.UUID `json:"in_reply_to_id"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	reqData := reqBody{}
+	err := decoder.Decode(&reqData)
 	if err != nil {
-		respondWithError(w, 400, err.Error())
+		respondWithError(w, 400, "invalid request body")
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
 		return
 	}
-	userId, err := auth.ValidateJWT(token, os.Getenv("SECRET_KEY"))
+	defer tx.Rollback()
+	qtx := cfg.queries.WithTx(tx)
+
+	// the user stays locked until commit, so concurrent posts count in turn
+	user, err := qtx.GetUserByIdForUpdate(r.Context(), principal.UserID)
 	if err != nil {
 		respondWithError(w, 401, err.Error())
 		return
 	}
+	if cfg.requireVerifiedEmail && !user.EmailVerifiedAt.Valid {
+		respondWithError(w, 403, "verify your email address before chirping")
+		return
+	}
+	entitlements := entitlementsFor(user)
 
-	type reqBody struct {
-		Body string `json:"body"`
+	if utf8.RuneCountInString(reqData.Body) > entitlements.MaxChirpLength {
+		respondWithError(w, 400, fmt.Sprintf("chirp is too long, the limit is %d characters", entitlements.MaxChirpLength))
+		return
 	}
-	decoder := json.NewDecoder(r.Body)
-	reqData := reqBody{}
-	err = decoder.Decode(&reqData)
+
+	now := time.Now().UTC()
+	publishAt := now
+	if reqData.PublishAt != nil {
+		switch {
+		case entitlements.ScheduleAhead == 0:
+			respondWithError(w, 403, "scheduling chirps requires Chirpy Red")
+			return
+		case !reqData.PublishAt.After(now):
+			respondWithError(w, 400, "publish_at must be in the future")
+			return
+		case reqData.PublishAt.After(now.Add(entitlements.ScheduleAhead)):
+			respondWithError(w, 400, fmt.Sprintf("chirps can be scheduled at most %v ahead", entitlements.ScheduleAhead))
+			return
+		}
+		publishAt = reqData.PublishAt.UTC()
+	}
+
+	inReplyTo := uuid.NullUUID{}
+	if reqData.InReplyToID != nil {
+		parent, err := qtx.GetChirpById(r.Context(), *reqData.InReplyToID)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && parent.PublishAt.After(now)) {
+			respondWithError(w, 400, "in_reply_to_id does not match a published chirp")
+			return
+		}
+		if err != nil {
+			respondWithError(w, 500, err.Error())
+			return
+		}
+		inReplyTo = uuid.NullUUID{UUID: parent.ID, Valid: true}
+	}
+
+	recent, err := qtx.CountChirpsByUserSince(r.Context(), database.CountChirpsByUserSinceParams{
+		UserID:    user.ID,
+		CreatedAt: now.Add(-time.Hour),
+	})
 	if err != nil {
-		respondWithError(w, 400, "invalid request body")
+		respondWithError(w, 500, err.Error())
 		return
 	}
-
-	if len(reqData.Body) > 140 {
-		respondWithError(w, 400, "chirp is too long")
+	if recent >= entitlements.ChirpsPerHour {
+		respondWithError(w, 429, fmt.Sprintf("you can post at most %d chirps per hour", entitlements.ChirpsPerHour))
 		return
 	}
 
-	cleanedBody := censorChirp(reqData.Body, []string{"kerfuffle", "sharbert", "fornax"})
+	cleanedBody := censorChirp(reqData.Body, profaneWords)
 	params := database.CreateChirpParams{
-		Body:   cleanedBody,
-		UserID: userId,
+		CreatedAt:   now,
+		Body:        cleanedBody,
+		UserID:      principal.UserID,
+		InReplyToID: inReplyTo,
+		PublishAt:   publishAt,
 	}
-	c, err := cfg.queries.CreateChirp(r.Context(), params)
+	c, err := qtx.CreateChirp(r.Context(), params)
 	if err != nil {
 		respondWithError(w, 500, err.Error())
 		return
 	}
 
-	respPayload := Chirp{
-		ID:        c.ID,
-		CreatedAt: c.CreatedAt,
-		UpdatedAt: c.UpdatedAt,
-		Body:      c.Body,
-		UserID:    c.UserID,
+	if err = tx.Commit(); err != nil {
+		respondWithError(w, 500, err.Error())
+		return
 	}
-	respondWithJson(w, 201, respPayload)
+
+	respondWithJson(w, 201, chirpFromDB(c))
 }
 
 func (cfg *apiConfig) getChirpsHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
-	var cs []database.Chirp
-	var err error
-	var userId uuid.UUID
+	query := r.URL.Query()
 
-	authorQuery := r.URL.Query().Get("author_id")
-	if authorQuery != "" {
-		userId, err = uuid.Parse(authorQuery)
+	// scheduled chirps are left out until their publish time
+	params := database.ListChirpsAscParams{Now: time.Now().UTC()}
+	if authorQuery := query.Get("author_id"); authorQuery != "" {
+		userId, err := uuid.Parse(authorQuery)
 		if err != nil {
 			respondWithError(w, 400, err.Error())
 			return
 		}
-		cs, err = cfg.queries.GetChirpsByUser(r.Context(), userId)
+		params.AuthorID = uuid.NullUUID{UUID: userId, Valid: true}
+	}
+
+	limit, err := parseLimit(query.Get("limit"))
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	// fetch one extra row to know whether another page exists
+	params.Limit = int32(limit + 1)
+
+	sortQuery := query.Get("sort")
+	if sortQuery != "" && sortQuery != "asc" && sortQuery != "desc" {
+		respondWithError(w, 400, "sort must be asc or desc")
+		return
+	}
+	desc := sortQuery == "desc"
+
+	after, before := query.Get("after"), query.Get("before")
+	if after != "" && before != "" {
+		respondWithError(w, 400, "use either after or before, not both")
+		return
+	}
+	backward := before != ""
+	if cursorQuery := after + before; cursorQuery != "" {
+		cursor, err := decodeCursor(cursorQuery)
+		if err != nil {
+			respondWithError(w, 400, err.Error())
+			return
+		}
+		params.CursorPublishAt = sql.NullTime{Time: cursor.PublishAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	// walking backwards means reading the opposite order from the cursor
+	var cs []database.Chirp
+	if desc != backward {
+		cs, err = cfg.queries.ListChirpsDesc(r.Context(), database.ListChirpsDescParams(params))
 	} else {
-		cs, err = cfg.queries.GetChirps(r.Context())
+		cs, err = cfg.queries.ListChirpsAsc(r.Context(), params)
 	}
 	if err != nil {
 		respondWithError(w, 500, err.Error())
 		return
 	}
 
+	hasMore := len(cs) > limit
+	if hasMore {
+		cs = cs[:limit]
+	}
+	if backward {
+		slices.Reverse(cs)
+	}
+
 	chirps := make([]Chirp, len(cs))
 	for i, c := range cs {
-		chirps[i] = Chirp{
-			ID:        c.ID,
-			CreatedAt: c.CreatedAt,
-			UpdatedAt: c.UpdatedAt,
-			Body:      c.Body,
-			UserID:    c.UserID,
-		}
+		chirps[i] = chirpFromDB(c)
+	}
+	if err := cfg.addLikes(r, chirps); err != nil {
+		respondWithError(w, 500, err.Error())
+		return
 	}
 
-	if sortQuery := r.URL.Query().Get("sort"); sortQuery == "desc" {
-		sort.Slice(chirps, func(i, j int) bool {
-			return chirps[i].CreatedAt.After(chirps[j].CreatedAt)
-		})
+	if len(cs) > 0 {
+		first := chirpCursor{PublishAt: cs[0].PublishAt, ID: cs[0].ID}
+		last := chirpCursor{PublishAt: cs[len(cs)-1].PublishAt, ID: cs[len(cs)-1].ID}
+		if (backward && hasMore) || (!backward && after != "") {
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="prev"`, pageLink(r.URL, "before", first)))
+		}
+		if (!backward && hasMore) || backward {
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="next"`, pageLink(r.URL, "after", last)))
+		}
 	}
 
 	respondWithJson(w, 200, chirps)
@@ -285,14 +752,12 @@ func (cfg *apiConfig) getChirpById(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, 404, err.Error())
 		return
 	}
-	chirp := Chirp{
-		ID:        c.ID,
-		CreatedAt: c.CreatedAt,
-		UpdatedAt: c.UpdatedAt,
-		Body:      c.Body,
-		UserID:    c.UserID,
+	// scheduled chirps stay hidden until they are published
+	if c.PublishAt.After(time.Now().UTC()) {
+		respondWithError(w, 404, "chirp not found")
+		return
 	}
-	respondWithJson(w, 200, chirp)
+	cfg.respondWithChirp(w, r, c)
 }
 
 func (cfg *apiConfig) loginHandler(w http.ResponseWriter, r *http.Request) {
@@ -305,83 +770,100 @@ func (cfg *apiConfig) loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := cfg.queries.GetUserByEmail(r.Context(), reqData.Email)
-	if err != nil {
-		respondWithError(w, 401, "Incorrect email or password")
+	email := lookupEmail(reqData.Email)
+	if !cfg.checkLoginLockout(w, r, email) {
 		return
 	}
 
-	err = auth.CheckPassword(user.HashedPassword, reqData.Password)
+	user, err := findUserByEmail(r.Context(), cfg.queries, reqData.Email)
 	if err != nil {
+		cfg.recordLoginFailure(r, email)
 		respondWithError(w, 401, "Incorrect email or password")
 		return
 	}
 
-	refreshTokenExpAt := time.Now().AddDate(0, 0, 60)
-	refreshToken, _ := auth.MakeRefreshToken()
-	saveRefreshTokenParams := database.SaveRefreshTokenParams{
-		Token:     refreshToken,
-		UserID:    user.ID,
-		ExpiresAt: refreshTokenExpAt,
-	}
-	_, err = cfg.queries.SaveRefreshToken(r.Context(), saveRefreshTokenParams)
+	needsRehash, err := cfg.passwords.CheckPassword(user.HashedPassword, reqData.Password)
 	if err != nil {
-		respondWithError(w, 500, "Can not save refresh token")
+		cfg.recordLoginFailure(r, email)
+		respondWithError(w, 401, "Incorrect email or password")
 		return
 	}
+	if needsRehash {
+		cfg.rehashPassword(r, user.ID, reqData.Password)
+	}
 
-	accessTokenExpDuration := time.Hour
-	token, err := auth.MakeJWT(user.ID, os.Getenv("SECRET_KEY"), accessTokenExpDuration)
-	if err != nil {
-		respondWithError(w, 500, err.Error())
+	if user.TotpEnabledAt.Valid {
+		cfg.respondWithMFAChallenge(w, user)
 		return
 	}
 
-	respData := User{
-		ID:           user.ID,
-		CreatedAt:    user.CreatedAt,
-		UpdatedAt:    user.UpdatedAt,
-		Email:        user.Email,
-		Token:        token,
-		RefreshToken: refreshToken,
-		IsChirpyRed:  user.IsChirpyRed,
-	}
-	respondWithJson(w, 200, respData)
+	cfg.recordLoginSuccess(r, user.Email)
+	cfg.respondWithLogin(w, r, user)
 }
 
-func (cfg *apiConfig) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
-	token, err := auth.GetBearerToken(r.Header)
+// rehashPassword upgrades an outdated hash while the password is at hand.
+func (cfg *apiConfig) rehashPassword(r *http.Request, userId uuid.UUID, password string) {
+	hashedPassword, err := cfg.passwords.HashPassword(password)
 	if err != nil {
-		respondWithError(w, 401, err.Error())
+		log.Printf("rehashing password: %v", err)
 		return
 	}
-	tokenDb, err := cfg.queries.GetUserFromRefreshTokens(r.Context(), token)
+	_, err = cfg.queries.UpdatePassword(r.Context(), database.UpdatePasswordParams{
+		HashedPassword: hashedPassword,
+		ID:             userId,
+	})
 	if err != nil {
-		respondWithError(w, 401, "invalid refresh token")
-		return
+		log.Printf("rehashing password: %v", err)
 	}
+}
 
-	if tokenDb.ExpiresAt.Before(time.Now()) {
-		respondWithError(w, 401, "refresh token expired")
+// respondWithLogin starts a session for user and answers with its tokens.
+func (cfg *apiConfig) respondWithLogin(w http.ResponseWriter, r *http.Request, user database.User) {
+	if user.DeleteAfter.Valid {
+		err := cfg.queries.CancelUserDeletion(r.Context(), user.ID)
+		if err != nil {
+			respondWithError(w, 500, err.Error())
+			return
+		}
+	}
+
+	refreshToken, err := issueRefreshToken(
+		r.Context(),
+		cfg.queries,
+		user.ID,
+		uuid.New(),
+		sql.NullString{},
+		clientInfoFromRequest(r),
+	)
+	if err != nil {
+		respondWithError(w, 500, "Can not save refresh token")
 		return
 	}
 
-	// make jwt
-	jwt, err := auth.MakeJWT(tokenDb.UserID, os.Getenv("SECRET_KEY"), time.Hour)
+	token, err := cfg.jwtKeys.MakeJWT(auth.Principal{
+		UserID: user.ID,
+		Role:   user.Role,
+		Scopes: auth.ScopesForRole(user.Role),
+	}, accessTokenTTL)
 	if err != nil {
 		respondWithError(w, 500, err.Error())
+		return
 	}
 
-	type respData struct {
-		Token string `json:"token"`
+	respData := User{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		Token:         token,
+		RefreshToken:  refreshToken,
+		IsChirpyRed:   isChirpyRed(user),
+		EmailVerified: user.EmailVerifiedAt.Valid,
 	}
-
-	respBody := respData{Token: jwt}
-	respondWithJson(w, 200, respBody)
+	respondWithJson(w, 200, respData)
 }
 
-func (cfg *apiConfig) revokeAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+func (cfg *apiConfig) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
@@ -389,145 +871,141 @@ func (cfg *apiConfig) revokeAccessTokenHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	err = cfg.queries.RevokeRefreshToken(r.Context(), token)
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
 	if err != nil {
-		respondWithError(w, 401, err.Error())
+		respondWithError(w, 500, err.Error())
 		return
 	}
-
-	w.WriteHeader(204)
-}
-
-func (cfg *apiConfig) updateEmailAndPasswordHandler(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
-	accessToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, 401, err.Error())
+	defer tx.Rollback()
+	qtx := cfg.queries.WithTx(tx)
+
+	// a single conditional update, so concurrent refreshes can not both succeed
+	tokenHash := auth.HashToken(token)
+	tokenDb, err := qtx.ConsumeRefreshToken(r.Context(), database.ConsumeRefreshTokenParams{
+		TokenHash: tokenHash,
+		Now:       time.Now().UTC(),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		cfg.rejectRefreshToken(w, r, tokenHash)
 		return
 	}
-	userId, err := auth.ValidateJWT(accessToken, os.Getenv("SECRET_KEY"))
 	if err != nil {
-		respondWithError(w, 401, err.Error())
+		respondWithError(w, 500, err.Error())
 		return
 	}
 
-	reqBody := authReqBody{}
-	decoder := json.NewDecoder(r.Body)
-	err = decoder.Decode(&reqBody)
+	// the role is read again so role changes apply on refresh
+	user, err := qtx.GetUserById(r.Context(), tokenDb.UserID)
 	if err != nil {
-		respondWithError(w, 400, err.Error())
+		respondWithError(w, 401, err.Error())
 		return
 	}
 
-	user, _ := cfg.queries.GetUserByEmail(r.Context(), reqBody.Email)
-	if userId != user.ID {
-		respondWithError(w, 401, "can not update others")
+	newRefreshToken, err := issueRefreshToken(
+		r.Context(),
+		qtx,
+		tokenDb.UserID,
+		tokenDb.FamilyID,
+		sql.NullString{String: tokenDb.TokenHash, Valid: true},
+		clientInfoFromRequest(r),
+	)
+	if err != nil {
+		respondWithError(w, 500, "Can not save refresh token")
 		return
 	}
 
-	hashPwd, err := auth.HashPassword(reqBody.Password)
-	if err != nil {
-		respondWithError(w, 400, err.Error())
+	if err = tx.Commit(); err != nil {
+		respondWithError(w, 500, err.Error())
 		return
 	}
 
-	updatedUser, err := cfg.queries.UpdateEmailAndPassword(
-		r.Context(),
-		database.UpdateEmailAndPasswordParams{
-			Email:          reqBody.Email,
-			HashedPassword: hashPwd,
-			ID:             userId,
-		},
-	)
+	// make jwt
+	jwt, err := cfg.jwtKeys.MakeJWT(auth.Principal{
+		UserID: user.ID,
+		Role:   user.Role,
+		Scopes: auth.ScopesForRole(user.Role),
+	}, accessTokenTTL)
 	if err != nil {
-		respondWithError(w, 401, err.Error())
+		respondWithError(w, 500, err.Error())
 		return
 	}
 
-	respBody := User{
-		ID:          userId,
-		CreatedAt:   updatedUser.CreatedAt,
-		UpdatedAt:   updatedUser.UpdatedAt,
-		Email:       updatedUser.Email,
-		IsChirpyRed: updatedUser.IsChirpyRed,
+	type respData struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
+
+	respBody := respData{Token: jwt, RefreshToken: newRefreshToken}
 	respondWithJson(w, 200, respBody)
 }
 
-func (cfg *apiConfig) deleteChirpHandler(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
-	token, err := auth.GetBearerToken(r.Header)
+// rejectRefreshToken answers a failed refresh, revoking the family on reuse.
+func (cfg *apiConfig) rejectRefreshToken(w http.ResponseWriter, r *http.Request, tokenHash string) {
+	tokenDb, err := cfg.queries.GetUserFromRefreshTokens(r.Context(), tokenHash)
 	if err != nil {
-		respondWithError(w, 403, err.Error())
+		respondWithError(w, 401, "invalid refresh token")
 		return
 	}
-	userId, err := auth.ValidateJWT(token, os.Getenv("SECRET_KEY"))
-	if err != nil {
-		respondWithError(w, 403, err.Error())
-		return
+
+	switch {
+	case tokenDb.UsedAt.Valid:
+		_, err = cfg.queries.RevokeRefreshTokenFamily(r.Context(), database.RevokeRefreshTokenFamilyParams{
+			FamilyID: tokenDb.FamilyID,
+			UserID:   tokenDb.UserID,
+		})
+		if err != nil {
+			respondWithError(w, 500, err.Error())
+			return
+		}
+		respondWithError(w, 401, "refresh token reuse detected")
+	case tokenDb.RevokedAt.Valid:
+		respondWithError(w, 401, "refresh token revoked")
+	default:
+		respondWithError(w, 401, "refresh token expired")
 	}
+}
 
-	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+func (cfg *apiConfig) revokeAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		respondWithError(w, 404, err.Error())
+		respondWithError(w, 401, err.Error())
 		return
 	}
 
-	chirp, err := cfg.queries.GetChirpById(r.Context(), chirpId)
+	err = cfg.queries.RevokeRefreshToken(r.Context(), auth.HashToken(token))
 	if err != nil {
-		respondWithError(w, 404, err.Error())
-		return
-	}
-	if chirp.UserID != userId {
-		respondWithError(w, 403, "can't delete others chirp")
+		respondWithError(w, 401, err.Error())
 		return
 	}
 
-	err = cfg.queries.DeleteChirpById(r.Context(), chirpId)
-	if err != nil {
-		respondWithError(w, 500, err.Error())
-	}
 	w.WriteHeader(204)
 }
 
-func (cfg *apiConfig) polkaWebhookHandler(w http.ResponseWriter, r *http.Request) {
+func (cfg *apiConfig) deleteChirpHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
-	type reqBody struct {
-		Event string `json:"event"`
-		Data  struct {
-			UserID uuid.UUID `json:"user_id"`
-		} `json:"data"`
-	}
+	principal, _ := auth.PrincipalFromContext(r.Context())
 
-	reqData := reqBody{}
-	decoder := json.NewDecoder(r.Body)
-	err := decoder.Decode(&reqData)
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
 	if err != nil {
-		respondWithError(w, 400, err.Error())
+		respondWithError(w, 404, err.Error())
 		return
 	}
 
-	apiKey, err := auth.GetAPIKey(r.Header)
+	chirp, err := cfg.queries.GetChirpById(r.Context(), chirpId)
 	if err != nil {
-		respondWithError(w, 400, err.Error())
-		return
-	}
-	if apiKey != os.Getenv("POLKA_KEY") {
-		w.WriteHeader(401)
+		respondWithError(w, 404, err.Error())
 		return
 	}
-
-	if reqData.Event != "user.upgraded" {
-		w.WriteHeader(204)
+	if chirp.UserID != principal.UserID && !principal.HasRole(auth.RoleModerator, auth.RoleAdmin) {
+		respondWithError(w, 403, "can't delete others chirp")
 		return
 	}
 
-	_, err = cfg.queries.UpgradeUserById(r.Context(), reqData.Data.UserID)
+	err = cfg.queries.DeleteChirpById(r.Context(), chirpId)
 	if err != nil {
-		respondWithError(w, 404, err.Error())
-		return
+		respondWithError(w, 500, err.Error())
 	}
-
 	w.WriteHeader(204)
 }
 
@@ -554,6 +1032,8 @@ func respondWithError(w http.ResponseWriter, code int, message string) error {
 	return respondWithJson(w, code, map[string]string{"error": message})
 }
 
+var profaneWords = []string{"kerfuffle", "sharbert", "fornax"}
+
 func censorChirp(chirp string, profane []string) string {
 
 	separateWords := strings.Split(chirp, " ")
@@ -0,0 +1,514 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/babanini95/chirpy/internal/auth"
+	"github.com/babanini95/chirpy/internal/database"
+	"github.com/babanini95/chirpy/internal/oidc"
+	"github.com/google/uuid"
+)
+
+const (
+	// oauthCodeTTL is how long a third-party app has to exchange the code
+	// it was redirected with.
+	oauthCodeTTL      = 5 * time.Minute
+	oauthMaxBodyBytes = 1 << 16
+)
+
+// authorizeRequest is an RFC 6749 authorization request with PKCE.
+type authorizeRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+func authorizeRequestFromQuery(query url.Values) authorizeRequest {
+	return authorizeRequest{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+}
+
+// checkAuthorizeRequest resolves the client, redirect URI and scopes asked for.
+func (cfg *apiConfig) checkAuthorizeRequest(w http.ResponseWriter, r *http.Request, req *authorizeRequest) (database.OauthClient, []string, bool) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	if req.ResponseType != "code" {
+		respondWithError(w, 400, "response_type must be code")
+		return database.OauthClient{}, nil, false
+	}
+	clientId, err := uuid.Parse(req.ClientID)
+	if err != nil {
+		respondWithError(w, 400, "unknown client")
+		return database.OauthClient{}, nil, false
+	}
+	client, err := cfg.queries.GetOAuthClient(r.Context(), clientId)
+	if err != nil {
+		respondWithError(w, 400, "unknown client")
+		return database.OauthClient{}, nil, false
+	}
+
+	redirectURIs := strings.Fields(client.RedirectUris)
+	if req.RedirectURI == "" && len(redirectURIs) == 1 {
+		req.RedirectURI = redirectURIs[0]
+	}
+	if !slices.Contains(redirectURIs, req.RedirectURI) {
+		respondWithError(w, 400, "redirect_uri is not registered for this client")
+		return database.OauthClient{}, nil, false
+	}
+
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		respondWithError(w, 400, "a PKCE code_challenge with code_challenge_method S256 is required")
+		return database.OauthClient{}, nil, false
+	}
+
+	scopes := strings.Fields(req.Scope)
+	if len(scopes) == 0 {
+		scopes = strings.Fields(client.Scopes)
+	}
+	allowed := auth.ScopesForRole(principal.Role)
+	for _, scope := range scopes {
+		if !slices.Contains(strings.Fields(client.Scopes), scope) || !slices.Contains(allowed, scope) {
+			respondWithError(w, 400, "invalid scope "+scope)
+			return database.OauthClient{}, nil, false
+		}
+	}
+	return client, scopes, true
+}
+
+// getAuthorizeHandler tells the frontend what the app asks for.
+func (cfg *apiConfig) getAuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	req := authorizeRequestFromQuery(r.URL.Query())
+	client, scopes, ok := cfg.checkAuthorizeRequest(w, r, &req)
+	if !ok {
+		return
+	}
+
+	consentRequired := true
+	consent, err := cfg.queries.GetOAuthConsent(r.Context(), database.GetOAuthConsentParams{
+		UserID:   principal.UserID,
+		ClientID: client.ID,
+	})
+	if err == nil {
+		consentRequired = !isSubset(scopes, strings.Fields(consent.Scopes))
+	}
+
+	type respData struct {
+		ClientID        uuid.UUID `json:"client_id"`
+		ClientName      string    `json:"client_name"`
+		RedirectURI     string    `json:"redirect_uri"`
+		Scopes          []string  `json:"scopes"`
+		ConsentRequired bool      `json:"consent_required"`
+	}
+	respondWithJson(w, 200, respData{
+		ClientID:        client.ID,
+		ClientName:      client.Name,
+		RedirectURI:     req.RedirectURI,
+		Scopes:          scopes,
+		ConsentRequired: consentRequired,
+	})
+}
+
+// authorizeHandler records the user's decision and answers with the redirect.
+func (cfg *apiConfig) authorizeHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	type reqBody struct {
+		authorizeRequest
+		Approve bool `json:"approve"`
+	}
+	reqData := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&reqData)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	client, scopes, ok := cfg.checkAuthorizeRequest(w, r, &reqData.authorizeRequest)
+	if !ok {
+		return
+	}
+
+	type respData struct {
+		RedirectTo string `json:"redirect_to"`
+	}
+	params := url.Values{}
+	if reqData.State != "" {
+		params.Set("state", reqData.State)
+	}
+	if !reqData.Approve {
+		params.Set("error", "access_denied")
+		respondWithJson(w, 200, respData{RedirectTo: withQuery(reqData.RedirectURI, params)})
+		return
+	}
+
+	code, err := auth.MakeOpaqueToken()
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.queries.WithTx(tx)
+
+	// consent only grows
+	granted := slices.Clone(scopes)
+	consent, err := qtx.GetOAuthConsent(r.Context(), database.GetOAuthConsentParams{
+		UserID:   principal.UserID,
+		ClientID: client.ID,
+	})
+	if err == nil {
+		for _, scope := range strings.Fields(consent.Scopes) {
+			if !slices.Contains(granted, scope) {
+				granted = append(granted, scope)
+			}
+		}
+	}
+	_, err = qtx.SaveOAuthConsent(r.Context(), database.SaveOAuthConsentParams{
+		UserID:   principal.UserID,
+		ClientID: client.ID,
+		Scopes:   strings.Join(granted, " "),
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	err = qtx.CreateOAuthAuthorizationCode(r.Context(), database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      client.ID,
+		UserID:        principal.UserID,
+		RedirectUri:   reqData.RedirectURI,
+		Scopes:        strings.Join(scopes, " "),
+		CodeChallenge: reqData.CodeChallenge,
+		ExpiresAt:     time.Now().UTC().Add(oauthCodeTTL),
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	params.Set("code", code)
+	respondWithJson(w, 200, respData{RedirectTo: withQuery(reqData.RedirectURI, params)})
+}
+
+func withQuery(rawURL string, params url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func isSubset(scopes, of []string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(of, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// respondWithOAuthError answers the token endpoint's clients in the format
+// of RFC 6749 section 5.2.
+func respondWithOAuthError(w http.ResponseWriter, code int, oauthError, description string) error {
+	type respData struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description,omitempty"`
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	return respondWithJson(w, code, respData{Error: oauthError, ErrorDescription: description})
+}
+
+// authenticateOAuthClient accepts basic auth or credentials in the form.
+func (cfg *apiConfig) authenticateOAuthClient(r *http.Request) (database.OauthClient, error) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	id, err := uuid.Parse(clientID)
+	if err != nil {
+		return database.OauthClient{}, errors.New("unknown client")
+	}
+	client, err := cfg.queries.GetOAuthClient(r.Context(), id)
+	if err != nil {
+		return database.OauthClient{}, errors.New("unknown client")
+	}
+	if client.SecretHash.Valid &&
+		subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+		return database.OauthClient{}, errors.New("invalid client secret")
+	}
+	return client, nil
+}
+
+// oauthTokenHandler is the token endpoint of RFC 6749 section 3.2,
+// supporting the authorization code and refresh token grants.
+func (cfg *apiConfig) oauthTokenHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	r.Body = http.MaxBytesReader(w, r.Body, oauthMaxBodyBytes)
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, 400, "invalid_request", err.Error())
+		return
+	}
+
+	client, err := cfg.authenticateOAuthClient(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		respondWithOAuthError(w, 401, "invalid_client", err.Error())
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.queries.WithTx(tx)
+
+	var userId uuid.UUID
+	var scopes []string
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code, err := qtx.ConsumeOAuthAuthorizationCode(r.Context(), database.ConsumeOAuthAuthorizationCodeParams{
+			CodeHash: auth.HashToken(r.PostForm.Get("code")),
+			Now:      time.Now().UTC(),
+		})
+		if err != nil {
+			respondWithOAuthError(w, 400, "invalid_grant", "invalid or expired code")
+			return
+		}
+		if code.ClientID != client.ID || code.RedirectUri != r.PostForm.Get("redirect_uri") {
+			respondWithOAuthError(w, 400, "invalid_grant", "code was issued to another client or redirect_uri")
+			return
+		}
+		if !oidc.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+			respondWithOAuthError(w, 400, "invalid_grant", "code_verifier does not match")
+			return
+		}
+		userId = code.UserID
+		scopes = strings.Fields(code.Scopes)
+	case "refresh_token":
+		tokenHash := auth.HashToken(r.PostForm.Get("refresh_token"))
+		token, err := qtx.ConsumeOAuthRefreshToken(r.Context(), database.ConsumeOAuthRefreshTokenParams{
+			TokenHash: tokenHash,
+			Now:       time.Now().UTC(),
+		})
+		if err != nil {
+			cfg.detectOAuthRefreshTokenReuse(r, tokenHash, client.ID)
+			respondWithOAuthError(w, 400, "invalid_grant", "invalid or expired refresh token")
+			return
+		}
+		if token.ClientID != client.ID {
+			respondWithOAuthError(w, 400, "invalid_grant", "refresh token was issued to another client")
+			return
+		}
+		userId = token.UserID
+		scopes = strings.Fields(token.Scopes)
+		// a client may ask for less than it was granted, never for more
+		if requested := strings.Fields(r.PostForm.Get("scope")); len(requested) > 0 {
+			if !isSubset(requested, scopes) {
+				respondWithOAuthError(w, 400, "invalid_scope", "scope exceeds what was granted")
+				return
+			}
+			scopes = requested
+		}
+	default:
+		respondWithOAuthError(w, 400, "unsupported_grant_type", "")
+		return
+	}
+
+	user, err := qtx.GetUserById(r.Context(), userId)
+	if err != nil {
+		respondWithOAuthError(w, 400, "invalid_grant", "user not found")
+		return
+	}
+	// like API keys, delegated access never outlives a demotion
+	allowed := auth.ScopesForRole(user.Role)
+	scopes = slices.DeleteFunc(scopes, func(scope string) bool {
+		return !slices.Contains(allowed, scope)
+	})
+
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	err = qtx.CreateOAuthRefreshToken(r.Context(), database.CreateOAuthRefreshTokenParams{
+		TokenHash: auth.HashToken(refreshToken),
+		ClientID:  client.ID,
+		UserID:    user.ID,
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: time.Now().UTC().Add(refreshTokenTTL),
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	// the app acts as an ordinary user, whatever the user's role
+	accessToken, err := cfg.jwtKeys.MakeJWT(auth.Principal{
+		UserID:   user.ID,
+		Role:     auth.RoleUser,
+		Scopes:   scopes,
+		ClientID: client.ID.String(),
+	}, accessTokenTTL)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	type respData struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJson(w, 200, respData{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(scopes, " "),
+	})
+}
+
+// detectOAuthRefreshTokenReuse revokes the client's tokens when a rotated one is reused.
+func (cfg *apiConfig) detectOAuthRefreshTokenReuse(r *http.Request, tokenHash string, clientId uuid.UUID) {
+	token, err := cfg.queries.GetOAuthRefreshToken(r.Context(), tokenHash)
+	if err != nil || !token.UsedAt.Valid || token.ClientID != clientId {
+		return
+	}
+	err = cfg.queries.RevokeOAuthRefreshTokens(r.Context(), database.RevokeOAuthRefreshTokensParams{
+		UserID:   token.UserID,
+		ClientID: token.ClientID,
+	})
+	if err != nil {
+		log.Printf("revoking reused oauth refresh tokens: %v", err)
+	}
+}
+
+// OAuthConsent is a third-party app the user allowed to act for them.
+type OAuthConsent struct {
+	ClientID   uuid.UUID `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (cfg *apiConfig) listOAuthConsentsHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	rows, err := cfg.queries.ListOAuthConsentsByUser(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	consents := make([]OAuthConsent, len(rows))
+	for i, row := range rows {
+		consents[i] = OAuthConsent{
+			ClientID:   row.ClientID,
+			ClientName: row.ClientName,
+			Scopes:     strings.Fields(row.Scopes),
+			CreatedAt:  row.CreatedAt,
+			UpdatedAt:  row.UpdatedAt,
+		}
+	}
+	respondWithJson(w, 200, consents)
+}
+
+// revokeOAuthConsentHandler disconnects an app from the caller.
+func (cfg *apiConfig) revokeOAuthConsentHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	clientId, err := uuid.Parse(r.PathValue("clientId"))
+	if err != nil {
+		respondWithError(w, 404, err.Error())
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.queries.WithTx(tx)
+
+	deleted, err := qtx.DeleteOAuthConsent(r.Context(), database.DeleteOAuthConsentParams{
+		UserID:   principal.UserID,
+		ClientID: clientId,
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, 404, "consent not found")
+		return
+	}
+	err = qtx.RevokeOAuthRefreshTokens(r.Context(), database.RevokeOAuthRefreshTokensParams{
+		UserID:   principal.UserID,
+		ClientID: clientId,
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	w.WriteHeader(204)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/babanini95/chirpy/internal/auth"
+	"github.com/babanini95/chirpy/internal/database"
+	"github.com/babanini95/chirpy/internal/validate"
+	"github.com/google/uuid"
+)
+
+// OAuthClient is a third-party app registered to act for Chirpy users.
+type OAuthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+}
+
+func oauthClientFromDB(client database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID:           client.ID,
+		CreatedAt:    client.CreatedAt,
+		Name:         client.Name,
+		RedirectURIs: strings.Fields(client.RedirectUris),
+		Scopes:       strings.Fields(client.Scopes),
+		Confidential: client.SecretHash.Valid,
+	}
+}
+
+// checkRedirectURI accepts https URLs, and http to the loopback address.
+func checkRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return fmt.Errorf("must be absolute URLs")
+	}
+	if u.Fragment != "" || strings.Contains(raw, " ") {
+		return fmt.Errorf("must not have a fragment or spaces")
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if host := u.Hostname(); host == "localhost" || host == "127.0.0.1" || host == "::1" {
+			return nil
+		}
+	}
+	return fmt.Errorf("must use https")
+}
+
+func (cfg *apiConfig) createOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	type reqBody struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Confidential bool     `json:"confidential"`
+	}
+	reqData := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&reqData)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	errs := validate.FieldErrors{}
+	reqData.Name = strings.TrimSpace(reqData.Name)
+	if reqData.Name == "" {
+		errs.Add("name", "is required")
+	}
+	if len(reqData.RedirectURIs) == 0 {
+		errs.Add("redirect_uris", "are required")
+	}
+	for _, uri := range reqData.RedirectURIs {
+		if err := checkRedirectURI(uri); err != nil {
+			errs.Add("redirect_uris", err.Error())
+		}
+	}
+	if len(reqData.Scopes) == 0 {
+		reqData.Scopes = auth.DelegableScopes
+	}
+	for _, scope := range reqData.Scopes {
+		if !slices.Contains(auth.DelegableScopes, scope) {
+			errs.Add("scopes", fmt.Sprintf("must be a subset of %v", auth.DelegableScopes))
+		}
+	}
+	if len(errs) > 0 {
+		respondWithFieldErrors(w, errs)
+		return
+	}
+
+	secret := ""
+	secretHash := sql.NullString{}
+	if reqData.Confidential {
+		secret, err = auth.MakeOpaqueToken()
+		if err != nil {
+			respondWithError(w, 500, err.Error())
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	dbClient, err := cfg.queries.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		OwnerID:      principal.UserID,
+		Name:         reqData.Name,
+		SecretHash:   secretHash,
+		RedirectUris: strings.Join(reqData.RedirectURIs, " "),
+		Scopes:       strings.Join(reqData.Scopes, " "),
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	client := oauthClientFromDB(dbClient)
+	client.ClientSecret = secret
+	respondWithJson(w, 201, client)
+}
+
+func (cfg *apiConfig) listOAuthClientsHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	dbClients, err := cfg.queries.ListOAuthClientsByOwner(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	clients := make([]OAuthClient, len(dbClients))
+	for i, dbClient := range dbClients {
+		clients[i] = oauthClientFromDB(dbClient)
+	}
+	respondWithJson(w, 200, clients)
+}
+
+// revokeOAuthClientHandler stops the client from getting new tokens.
+func (cfg *apiConfig) revokeOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	clientId, err := uuid.Parse(r.PathValue("clientId"))
+	if err != nil {
+		respondWithError(w, 404, err.Error())
+		return
+	}
+
+	revoked, err := cfg.queries.RevokeOAuthClient(r.Context(), database.RevokeOAuthClientParams{
+		ID:      clientId,
+		OwnerID: principal.UserID,
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, 404, "client not found")
+		return
+	}
+
+	w.WriteHeader(204)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/babanini95/chirpy/internal/auth"
+	"github.com/babanini95/chirpy/internal/database"
+	"github.com/babanini95/chirpy/internal/oidc"
+	"github.com/google/uuid"
+)
+
+func TestCheckRedirectURI(t *testing.T) {
+	tests := []struct {
+		uri   string
+		valid bool
+	}{
+		{"https://app.example.com/callback", true},
+		{"https://app.example.com/callback?tenant=1", true},
+		{"http://localhost:3000/callback", true},
+		{"http://127.0.0.1/callback", true},
+		{"http://app.example.com/callback", false},
+		{"https://app.example.com/callback#token", false},
+		{"/callback", false},
+		{"javascript:alert(1)", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.uri, func(t *testing.T) {
+			err := checkRedirectURI(test.uri)
+			if (err == nil) != test.valid {
+				t.Errorf("got %v, expected valid=%v", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestWithQuery(t *testing.T) {
+	got := withQuery("https://app.example.com/callback?tenant=1", url.Values{"code": {"abc"}, "state": {"x y"}})
+	expected := "https://app.example.com/callback?code=abc&state=x+y&tenant=1"
+	if got != expected {
+		t.Errorf("got %s, expected %s", got, expected)
+	}
+}
+
+var oauthClientColumns = []string{"id", "created_at", "owner_id", "name", "secret_hash", "redirect_uris", "scopes", "revoked_at"}
+
+func oauthClientRows(c database.OauthClient) *sqlmock.Rows {
+	return mockRows(oauthClientColumns, []any{
+		c.ID, c.CreatedAt, c.OwnerID, c.Name, c.SecretHash, c.RedirectUris, c.Scopes, c.RevokedAt,
+	})
+}
+
+var oauthCodeColumns = []string{
+	"code_hash", "created_at", "client_id", "user_id", "redirect_uri", "scopes", "code_challenge", "expires_at", "used_at",
+}
+
+func oauthCodeRows(c database.OauthAuthorizationCode) *sqlmock.Rows {
+	return mockRows(oauthCodeColumns, []any{
+		c.CodeHash, c.CreatedAt, c.ClientID, c.UserID, c.RedirectUri, c.Scopes, c.CodeChallenge, c.ExpiresAt, c.UsedAt,
+	})
+}
+
+var oauthRefreshTokenColumns = []string{"token_hash", "created_at", "client_id", "user_id", "scopes", "expires_at", "used_at", "revoked_at"}
+
+func oauthRefreshTokenRows(t database.OauthRefreshToken) *sqlmock.Rows {
+	return mockRows(oauthRefreshTokenColumns, []any{
+		t.TokenHash, t.CreatedAt, t.ClientID, t.UserID, t.Scopes, t.ExpiresAt, t.UsedAt, t.RevokedAt,
+	})
+}
+
+func oauthTokenRequest(form url.Values) *http.Request {
+	r := httptest.NewRequest("POST", "/api/oauth/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func TestOAuthTokenAuthorizationCode(t *testing.T) {
+	now := time.Now().UTC()
+	redirectURI := "https://app.example.com/callback"
+	client := database.OauthClient{
+		ID:           uuid.New(),
+		CreatedAt:    now,
+		OwnerID:      uuid.New(),
+		Name:         "app",
+		RedirectUris: redirectURI,
+		Scopes:       auth.ScopeChirpsWrite,
+	}
+	// a moderator connecting an app must not hand it their role
+	user := database.User{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Email: "mod@example.com", Role: auth.RoleModerator}
+	verifier := "a-code-verifier-that-is-long-enough-for-pkce"
+
+	code := func(clientID uuid.UUID) *database.OauthAuthorizationCode {
+		return &database.OauthAuthorizationCode{
+			CodeHash:      auth.HashToken("code"),
+			CreatedAt:     now,
+			ClientID:      clientID,
+			UserID:        user.ID,
+			RedirectUri:   redirectURI,
+			Scopes:        auth.ScopeChirpsWrite,
+			CodeChallenge: oidc.PKCEChallenge(verifier),
+			ExpiresAt:     now.Add(oauthCodeTTL),
+			UsedAt:        sql.NullTime{Time: now, Valid: true},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		code        *database.OauthAuthorizationCode
+		redirectURI string
+		verifier    string
+		expected    int
+	}{
+		{"valid code", code(client.ID), redirectURI, verifier, 200},
+		{"reused or expired code", nil, redirectURI, verifier, 400},
+		{"code of another client", code(uuid.New()), redirectURI, verifier, 400},
+		{"another redirect_uri", code(client.ID), "https://app.example.com/other", verifier, 400},
+		{"wrong code_verifier", code(client.ID), redirectURI, "not-the-verifier", 400},
+		{"missing code_verifier", code(client.ID), redirectURI, "", 400},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, mock := newTestConfig(t)
+
+			mock.ExpectQuery(queryName("GetOAuthClient")).WillReturnRows(oauthClientRows(client))
+			mock.ExpectBegin()
+			if test.code == nil {
+				mock.ExpectQuery(queryName("ConsumeOAuthAuthorizationCode")).WillReturnRows(mockRows(oauthCodeColumns))
+			} else {
+				mock.ExpectQuery(queryName("ConsumeOAuthAuthorizationCode")).WillReturnRows(oauthCodeRows(*test.code))
+			}
+			if test.expected == 200 {
+				mock.ExpectQuery(queryName("GetUserById")).WillReturnRows(userRows(user))
+				mock.ExpectExec(queryName("CreateOAuthRefreshToken")).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			w := httptest.NewRecorder()
+			cfg.oauthTokenHandler(w, oauthTokenRequest(url.Values{
+				"grant_type":    {"authorization_code"},
+				"client_id":     {client.ID.String()},
+				"code":          {"code"},
+				"redirect_uri":  {test.redirectURI},
+				"code_verifier": {test.verifier},
+			}))
+
+			if w.Code != test.expected {
+				t.Fatalf("got %d, expected %d: %s", w.Code, test.expected, w.Body)
+			}
+			if test.expected != 200 {
+				return
+			}
+
+			var resp struct {
+				AccessToken string `json:"access_token"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			principal, err := cfg.jwtKeys.ValidateJWT(resp.AccessToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if principal.Role != auth.RoleUser || !principal.Delegated() || !slices.Equal(principal.Scopes, []string{auth.ScopeChirpsWrite}) {
+				t.Errorf("expected a delegated user token for %s, got %+v", auth.ScopeChirpsWrite, principal)
+			}
+		})
+	}
+}
+
+func TestOAuthTokenRefreshTokenReuse(t *testing.T) {
+	cfg, mock := newTestConfig(t)
+	now := time.Now().UTC()
+	client := database.OauthClient{ID: uuid.New(), CreatedAt: now, OwnerID: uuid.New(), Name: "app"}
+	token := database.OauthRefreshToken{
+		TokenHash: auth.HashToken("rotated"),
+		CreatedAt: now,
+		ClientID:  client.ID,
+		UserID:    uuid.New(),
+		Scopes:    auth.ScopeChirpsWrite,
+		ExpiresAt: now.Add(refreshTokenTTL),
+		UsedAt:    sql.NullTime{Time: now, Valid: true},
+	}
+
+	mock.ExpectQuery(queryName("GetOAuthClient")).WillReturnRows(oauthClientRows(client))
+	mock.ExpectBegin()
+	mock.ExpectQuery(queryName("ConsumeOAuthRefreshToken")).WillReturnRows(mockRows(oauthRefreshTokenColumns))
+	mock.ExpectQuery(queryName("GetOAuthRefreshToken")).WillReturnRows(oauthRefreshTokenRows(token))
+	// the whole grant goes, not just the token that came back
+	mock.ExpectExec(queryName("RevokeOAuthRefreshTokens")).
+		WithArgs(token.UserID.String(), client.ID.String()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectRollback()
+
+	w := httptest.NewRecorder()
+	cfg.oauthTokenHandler(w, oauthTokenRequest(url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {client.ID.String()},
+		"refresh_token": {"rotated"},
+	}))
+
+	if w.Code != 400 || !strings.Contains(w.Body.String(), "invalid_grant") {
+		t.Errorf("got %d %s, expected an invalid_grant", w.Code, w.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expected the grant to be revoked: %v", err)
+	}
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/babanini95/chirpy/internal/auth"
+	"github.com/babanini95/chirpy/internal/database"
+	"github.com/babanini95/chirpy/internal/oidc"
+	"github.com/babanini95/chirpy/internal/validate"
+	"github.com/google/uuid"
+)
+
+const (
+	// oidcLoginTTL is how long the user has to sign in at the provider.
+	oidcLoginTTL = 10 * time.Minute
+	// oidcStateCookie ties the callback to the browser that started the login.
+	oidcStateCookie = "chirpy_oidc_state"
+)
+
+// loadOIDCProviders configures each provider in OIDC_PROVIDERS from its
+// OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID and OIDC_<NAME>_CLIENT_SECRET.
+func loadOIDCProviders(baseURL string) (map[string]*oidc.Provider, error) {
+	providers := map[string]*oidc.Provider{}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		cfg := oidc.Config{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  fmt.Sprintf("%s/api/auth/%s/callback", baseURL, name),
+		}
+		if cfg.Issuer == "" || cfg.ClientID == "" {
+			return nil, fmt.Errorf("OIDC provider %s: %sISSUER and %sCLIENT_ID are required", name, prefix, prefix)
+		}
+		providers[name] = oidc.NewProvider(cfg, nil)
+	}
+	return providers, nil
+}
+
+// LinkedIdentity is an external login connected to a Chirpy account.
+type LinkedIdentity struct {
+	ID          uuid.UUID  `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Provider    string     `json:"provider"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+func linkedIdentityFromDB(dbIdentity database.UserIdentity) LinkedIdentity {
+	identity := LinkedIdentity{
+		ID:        dbIdentity.ID,
+		CreatedAt: dbIdentity.CreatedAt,
+		Provider:  dbIdentity.Provider,
+		Email:     dbIdentity.Email,
+	}
+	if dbIdentity.LastLoginAt.Valid {
+		identity.LastLoginAt = &dbIdentity.LastLoginAt.Time
+	}
+	return identity
+}
+
+func (cfg *apiConfig) oidcProvider(w http.ResponseWriter, r *http.Request) (*oidc.Provider, bool) {
+	provider, ok := cfg.oidcProviders[r.PathValue("provider")]
+	if !ok {
+		respondWithError(w, 404, "unknown login provider")
+		return nil, false
+	}
+	return provider, true
+}
+
+// oidcLoginHandler sends the browser to the provider to sign in.
+func (cfg *apiConfig) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	provider, ok := cfg.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+
+	authURL, err := cfg.startOIDCLogin(w, r, provider, uuid.NullUUID{})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oidcLinkHandler answers with the URL that links another login to the caller.
+func (cfg *apiConfig) oidcLinkHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	provider, ok := cfg.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	authURL, err := cfg.startOIDCLogin(w, r, provider, uuid.NullUUID{UUID: principal.UserID, Valid: true})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	type respData struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+	respondWithJson(w, 200, respData{AuthorizationURL: authURL})
+}
+
+// startOIDCLogin stores a new login until the provider redirects back.
+func (cfg *apiConfig) startOIDCLogin(w http.ResponseWriter, r *http.Request, provider *oidc.Provider, userId uuid.NullUUID) (string, error) {
+	state, err := auth.MakeOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := auth.MakeOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := oidc.NewPKCEVerifier()
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		return "", err
+	}
+
+	err = cfg.queries.CreateOIDCLogin(r.Context(), database.CreateOIDCLoginParams{
+		StateHash:    auth.HashToken(state),
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		UserID:       userId,
+		ExpiresAt:    time.Now().UTC().Add(oidcLoginTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/auth/" + provider.Name(),
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(cfg.baseURL, "https://"),
+		// Lax still sends the cookie on the provider's top level redirect
+		SameSite: http.SameSiteLaxMode,
+	})
+	return authURL, nil
+}
+
+// purgeExpiredOIDCLogins deletes expired logins every interval.
+func (cfg *apiConfig) purgeExpiredOIDCLogins(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := cfg.queries.DeleteExpiredOIDCLogins(ctx, time.Now().UTC())
+		if err != nil {
+			log.Printf("purging expired oidc logins: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	provider, ok := cfg.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+
+	if e := query.Get("error"); e != "" {
+		respondWithError(w, 401, fmt.Sprintf("login at %s failed: %s %s", provider.Name(), e, query.Get("error_description")))
+		return
+	}
+
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		respondWithError(w, 401, "login was not started from this browser")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:   oidcStateCookie,
+		Path:   "/api/auth/" + provider.Name(),
+		MaxAge: -1,
+	})
+
+	login, err := cfg.queries.ConsumeOIDCLogin(r.Context(), database.ConsumeOIDCLoginParams{
+		StateHash: auth.HashToken(state),
+		Provider:  provider.Name(),
+		Now:       time.Now().UTC(),
+	})
+	if err != nil {
+		respondWithError(w, 401, "login expired, please try again")
+		return
+	}
+
+	idToken, err := provider.Exchange(r.Context(), query.Get("code"), login.CodeVerifier)
+	if err != nil {
+		respondWithError(w, 401, err.Error())
+		return
+	}
+	identity, err := provider.VerifyIDToken(r.Context(), idToken, login.Nonce)
+	if err != nil {
+		respondWithError(w, 401, err.Error())
+		return
+	}
+
+	if login.UserID.Valid {
+		cfg.linkIdentity(w, r, provider, login.UserID.UUID, identity)
+		return
+	}
+	cfg.loginWithIdentity(w, r, provider, identity)
+}
+
+// loginWithIdentity signs in the identity's user, or signs up a new one.
+func (cfg *apiConfig) loginWithIdentity(w http.ResponseWriter, r *http.Request, provider *oidc.Provider, identity oidc.Identity) {
+	linked, err := cfg.queries.GetUserIdentity(r.Context(), database.GetUserIdentityParams{
+		Provider: provider.Name(),
+		Subject:  identity.Subject,
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	var user database.User
+	if err == nil {
+		err = cfg.queries.TouchUserIdentity(r.Context(), database.TouchUserIdentityParams{
+			Email: identity.Email,
+			ID:    linked.ID,
+		})
+		if err != nil {
+			log.Printf("recording identity login: %v", err)
+		}
+		user, err = cfg.queries.GetUserById(r.Context(), linked.UserID)
+		if err != nil {
+			respondWithError(w, 500, err.Error())
+			return
+		}
+	} else {
+		var ok bool
+		user, ok = cfg.signUpWithIdentity(w, r, provider, identity)
+		if !ok {
+			return
+		}
+	}
+
+	if user.TotpEnabledAt.Valid {
+		cfg.respondWithMFAChallenge(w, user)
+		return
+	}
+	cfg.respondWithLogin(w, r, user)
+}
+
+// signUpWithIdentity creates a user without a password.
+func (cfg *apiConfig) signUpWithIdentity(w http.ResponseWriter, r *http.Request, provider *oidc.Provider, identity oidc.Identity) (database.User, bool) {
+	email, err := validate.NormalizeEmail(identity.Email)
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("%s did not share a usable email address", provider.Name()))
+		return database.User{}, false
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return database.User{}, false
+	}
+	defer tx.Rollback()
+	qtx := cfg.queries.WithTx(tx)
+
+	user, err := qtx.CreateUser(r.Context(), database.CreateUserParams{
+		Email:          email,
+		HashedPassword: "",
+	})
+	if isUniqueViolation(err) {
+		respondWithError(w, 409, fmt.Sprintf("an account with this email already exists, log in and link %s to it", provider.Name()))
+		return database.User{}, false
+	}
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return database.User{}, false
+	}
+	_, err = qtx.CreateUserIdentity(r.Context(), database.CreateUserIdentityParams{
+		UserID:   user.ID,
+		Provider: provider.Name(),
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return database.User{}, false
+	}
+	if identity.EmailVerified {
+		user, err = qtx.MarkEmailVerified(r.Context(), database.MarkEmailVerifiedParams{
+			ID:    user.ID,
+			Email: user.Email,
+		})
+		if err != nil {
+			respondWithError(w, 500, err.Error())
+			return database.User{}, false
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		respondWithError(w, 500, err.Error())
+		return database.User{}, false
+	}
+
+	if !user.EmailVerifiedAt.Valid {
+		err = cfg.sendVerificationEmail(r.Context(), user)
+		if err != nil {
+			log.Printf("sending verification email: %v", err)
+		}
+	}
+	return user, true
+}
+
+func (cfg *apiConfig) linkIdentity(w http.ResponseWriter, r *http.Request, provider *oidc.Provider, userId uuid.UUID, identity oidc.Identity) {
+	linked, err := cfg.queries.GetUserIdentity(r.Context(), database.GetUserIdentityParams{
+		Provider: provider.Name(),
+		Subject:  identity.Subject,
+	})
+	if err == nil {
+		if linked.UserID != userId {
+			respondWithError(w, 409, fmt.Sprintf("this %s account is linked to another Chirpy account", provider.Name()))
+			return
+		}
+		respondWithJson(w, 200, linkedIdentityFromDB(linked))
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	linked, err = cfg.queries.CreateUserIdentity(r.Context(), database.CreateUserIdentityParams{
+		UserID:   userId,
+		Provider: provider.Name(),
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if isUniqueViolation(err) {
+		respondWithError(w, 409, fmt.Sprintf("this %s account is linked to another Chirpy account", provider.Name()))
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	respondWithJson(w, 201, linkedIdentityFromDB(linked))
+}
+
+func (cfg *apiConfig) listIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	dbIdentities, err := cfg.queries.ListUserIdentitiesByUser(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	identities := make([]LinkedIdentity, len(dbIdentities))
+	for i, dbIdentity := range dbIdentities {
+		identities[i] = linkedIdentityFromDB(dbIdentity)
+	}
+	respondWithJson(w, 200, identities)
+}
+
+// unlinkIdentityHandler refuses to remove a passwordless user's last login.
+func (cfg *apiConfig) unlinkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	identityId, err := uuid.Parse(r.PathValue("identityId"))
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	user, err := cfg.queries.GetUserById(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 404, err.Error())
+		return
+	}
+	if user.HashedPassword == "" {
+		identities, err := cfg.queries.ListUserIdentitiesByUser(r.Context(), user.ID)
+		if err != nil {
+			respondWithError(w, 500, err.Error())
+			return
+		}
+		if len(identities) <= 1 {
+			respondWithError(w, 409, "set a password before unlinking your last login provider")
+			return
+		}
+	}
+
+	deleted, err := cfg.queries.DeleteUserIdentity(r.Context(), database.DeleteUserIdentityParams{
+		ID:     identityId,
+		UserID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, 404, "identity not found")
+		return
+	}
+	w.WriteHeader(204)
+}
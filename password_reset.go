@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/babanini95/chirpy/internal/auth"
+	"github.com/babanini95/chirpy/internal/database"
+	"github.com/babanini95/chirpy/internal/mailer"
+	"github.com/babanini95/chirpy/internal/validate"
+)
+
+const (
+	passwordResetTTL = time.Hour
+	// backgroundTimeout bounds the work left running after a response
+	backgroundTimeout = 30 * time.Second
+)
+
+// runInBackground calls fn after the handler has answered.
+func (cfg *apiConfig) runInBackground(r *http.Request, name string, fn func(ctx context.Context) error) {
+	ctx := context.WithoutCancel(r.Context())
+	cfg.background.Add(1)
+	go func() {
+		defer cfg.background.Done()
+		ctx, cancel := context.WithTimeout(ctx, backgroundTimeout)
+		defer cancel()
+		if err := fn(ctx); err != nil {
+			log.Printf("%s: %v", name, err)
+		}
+	}()
+}
+
+func (cfg *apiConfig) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type reqBody struct {
+		Email string `json:"email"`
+	}
+	reqData := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&reqData)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	if !cfg.checkMailLimit(w, r, "password-reset", reqData.Email) {
+		return
+	}
+
+	// the response never says whether the email belongs to an account
+	cfg.runInBackground(r, "sending password reset email", func(ctx context.Context) error {
+		return cfg.sendPasswordReset(ctx, reqData.Email)
+	})
+	w.WriteHeader(202)
+}
+
+// sendPasswordReset emails a reset link if email has an account.
+func (cfg *apiConfig) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := findUserByEmail(ctx, cfg.queries, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	resetToken, err := auth.MakeOpaqueToken()
+	if err != nil {
+		return err
+	}
+	_, err = cfg.queries.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(resetToken),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(passwordResetTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/app/reset-password?token=%s", cfg.baseURL, url.QueryEscape(resetToken))
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf(
+			"Someone asked to reset the password for your Chirpy account.\n\n"+
+				"Use this link within %v to choose a new one:\n%s\n\n"+
+				"If it wasn't you, you can ignore this email.",
+			passwordResetTTL,
+			link,
+		),
+	})
+}
+
+func (cfg *apiConfig) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type reqBody struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	reqData := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&reqData)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	if err := cfg.passwordPolicy.Check(reqData.Password); err != nil {
+		respondWithFieldErrors(w, validate.FieldErrors{"password": err.Error()})
+		return
+	}
+
+	hashedPassword, err := cfg.passwords.HashPassword(reqData.Password)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.queries.WithTx(tx)
+
+	resetToken, err := qtx.ConsumePasswordResetToken(r.Context(), database.ConsumePasswordResetTokenParams{
+		TokenHash: auth.HashToken(reqData.Token),
+		Now:       time.Now().UTC(),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 400, "invalid or expired reset token")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	_, err = qtx.UpdatePassword(r.Context(), database.UpdatePasswordParams{
+		HashedPassword: hashedPassword,
+		ID:             resetToken.UserID,
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	// other links and every session die with the old password
+	err = qtx.InvalidatePasswordResetTokensByUser(r.Context(), resetToken.UserID)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	err = qtx.RevokeAllRefreshTokensByUser(r.Context(), resetToken.UserID)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	err = qtx.RevokeAllOAuthRefreshTokensByUser(r.Context(), resetToken.UserID)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	w.WriteHeader(204)
+}
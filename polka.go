@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/babanini95/chirpy/internal/database"
+	"github.com/babanini95/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const (
+	polkaTimestampHeader = "X-Polka-Timestamp"
+	polkaSignatureHeader = "X-Polka-Signature"
+	// polkaWebhookTolerance bounds the clock skew with Polka.
+	polkaWebhookTolerance = 5 * time.Minute
+	polkaMaxBodyBytes     = 1 << 20
+	// chirpyRedPeriod is how long a payment buys without an end date.
+	chirpyRedPeriod = 30 * 24 * time.Hour
+)
+
+// Polka event types and the outcomes recorded for them.
+const (
+	polkaEventUpgraded      = "user.upgraded"
+	polkaEventDowngraded    = "user.downgraded"
+	polkaEventRenewed       = "subscription.renewed"
+	polkaEventPaymentFailed = "payment.failed"
+
+	polkaEventProcessed = "processed"
+	polkaEventIgnored   = "ignored"
+)
+
+type polkaEvent struct {
+	ID    string `json:"id"`
+	Event string `json:"event"`
+	Data  struct {
+		UserID uuid.UUID `json:"user_id"`
+		// ExpiresAt is the end of the paid period, when Polka sends it.
+		ExpiresAt *time.Time `json:"expires_at"`
+	} `json:"data"`
+}
+
+// errPolkaUserNotFound is answered with 404 so Polka retries.
+var errPolkaUserNotFound = errors.New("user not found")
+
+func (cfg *apiConfig) polkaWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	// the signature covers the raw body
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, polkaMaxBodyBytes))
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	err = cfg.polkaWebhook.Verify(r.Header, body)
+	if err != nil {
+		respondWithError(w, 401, err.Error())
+		return
+	}
+
+	event := polkaEvent{}
+	err = json.Unmarshal(body, &event)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	if event.ID == "" {
+		respondWithError(w, 400, "event id is required")
+		return
+	}
+
+	userId := uuid.NullUUID{}
+	if event.Data.UserID != uuid.Nil {
+		_, err = cfg.queries.GetUserById(r.Context(), event.Data.UserID)
+		if err == nil {
+			userId = uuid.NullUUID{UUID: event.Data.UserID, Valid: true}
+		}
+	}
+
+	replay, err := cfg.applyPolkaEvent(r, event, userId, body)
+	if err != nil {
+		cfg.recordFailedPolkaEvent(r, event, userId, body, err)
+		if errors.Is(err, errPolkaUserNotFound) {
+			respondWithError(w, 404, err.Error())
+			return
+		}
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	if replay {
+		log.Printf("ignoring replayed polka event %s", event.ID)
+	}
+
+	// replays are acknowledged too so Polka stops retrying them
+	w.WriteHeader(204)
+}
+
+// applyPolkaEvent records and applies the event, reporting if it was a duplicate.
+func (cfg *apiConfig) applyPolkaEvent(r *http.Request, event polkaEvent, userId uuid.NullUUID, payload []byte) (bool, error) {
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.queries.WithTx(tx)
+
+	claimed, err := qtx.ClaimPolkaEvent(r.Context(), database.ClaimPolkaEventParams{
+		EventID: event.ID,
+		Event:   event.Event,
+		UserID:  userId,
+		Payload: payload,
+	})
+	if err != nil {
+		return false, err
+	}
+	if claimed == 0 {
+		return true, nil
+	}
+
+	status := polkaEventProcessed
+	var notice *mailer.Message
+	switch event.Event {
+	case polkaEventUpgraded, polkaEventRenewed, polkaEventDowngraded, polkaEventPaymentFailed:
+		if !userId.Valid {
+			return false, errPolkaUserNotFound
+		}
+		notice, err = cfg.applyPolkaSubscriptionEvent(r, qtx, event)
+		if err != nil {
+			return false, err
+		}
+	default:
+		status = polkaEventIgnored
+	}
+
+	err = qtx.FinishPolkaEvent(r.Context(), database.FinishPolkaEventParams{
+		Status:  status,
+		EventID: event.ID,
+	})
+	if err != nil {
+		return false, err
+	}
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+
+	if notice != nil {
+		cfg.runInBackground(r, "sending payment failure notice", func(ctx context.Context) error {
+			return cfg.mailer.Send(ctx, *notice)
+		})
+	}
+	return false, nil
+}
+
+// applyPolkaSubscriptionEvent updates the user's plan, returning any email
+// to send once the event is committed.
+func (cfg *apiConfig) applyPolkaSubscriptionEvent(r *http.Request, qtx *database.Queries, event polkaEvent) (*mailer.Message, error) {
+	user, err := qtx.GetUserById(r.Context(), event.Data.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch event.Event {
+	case polkaEventUpgraded, polkaEventRenewed:
+		// a renewal arriving early adds to the time already paid for
+		until := time.Now().UTC()
+		if isChirpyRed(user) {
+			until = user.ChirpyRedUntil.Time
+		}
+		until = until.Add(chirpyRedPeriod)
+		if event.Data.ExpiresAt != nil {
+			until = event.Data.ExpiresAt.UTC()
+		}
+		_, err = qtx.SetChirpyRedUntil(r.Context(), database.SetChirpyRedUntilParams{
+			ChirpyRedUntil: sql.NullTime{Time: until, Valid: true},
+			ID:             user.ID,
+		})
+		return nil, err
+	case polkaEventDowngraded:
+		_, err = qtx.SetChirpyRedUntil(r.Context(), database.SetChirpyRedUntilParams{
+			ChirpyRedUntil: sql.NullTime{},
+			ID:             user.ID,
+		})
+		return nil, err
+	case polkaEventPaymentFailed:
+		// Chirpy Red runs out at the end of the paid period
+		if !isChirpyRed(user) {
+			return nil, nil
+		}
+		return &mailer.Message{
+			To:      user.Email,
+			Subject: "We could not renew your Chirpy Red subscription",
+			Body: fmt.Sprintf(
+				"Your last Chirpy Red payment failed. Update your payment details with Polka to keep Chirpy Red after %s.",
+				user.ChirpyRedUntil.Time.Format(time.RFC1123),
+			),
+		}, nil
+	}
+	return nil, nil
+}
+
+func (cfg *apiConfig) recordFailedPolkaEvent(r *http.Request, event polkaEvent, userId uuid.NullUUID, payload []byte, cause error) {
+	err := cfg.queries.FailPolkaEvent(r.Context(), database.FailPolkaEventParams{
+		EventID: event.ID,
+		Event:   event.Event,
+		UserID:  userId,
+		Payload: payload,
+		Error:   sql.NullString{String: cause.Error(), Valid: true},
+	})
+	if err != nil {
+		log.Printf("recording failed polka event %s: %v", event.ID, err)
+	}
+}
+
+// PolkaEvent is an entry of the webhook audit log.
+type PolkaEvent struct {
+	ID          string          `json:"id"`
+	Event       string          `json:"event"`
+	UserID      *uuid.UUID      `json:"user_id"`
+	Status      string          `json:"status"`
+	Error       string          `json:"error,omitempty"`
+	Payload     json.RawMessage `json:"payload"`
+	ReceivedAt  time.Time       `json:"received_at"`
+	ProcessedAt *time.Time      `json:"processed_at"`
+}
+
+func (cfg *apiConfig) listPolkaEventsHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	query := r.URL.Query()
+
+	limit, err := parseLimit(query.Get("limit"))
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	userId := uuid.NullUUID{}
+	if s := query.Get("user_id"); s != "" {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			respondWithError(w, 400, err.Error())
+			return
+		}
+		userId = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	dbEvents, err := cfg.queries.ListPolkaEvents(r.Context(), database.ListPolkaEventsParams{
+		UserID: userId,
+		Limit:  int32(limit),
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	events := make([]PolkaEvent, len(dbEvents))
+	for i, dbEvent := range dbEvents {
+		events[i] = PolkaEvent{
+			ID:         dbEvent.EventID,
+			Event:      dbEvent.Event,
+			Status:     dbEvent.Status,
+			Error:      dbEvent.Error.String,
+			Payload:    dbEvent.Payload,
+			ReceivedAt: dbEvent.ReceivedAt,
+		}
+		if dbEvent.UserID.Valid {
+			events[i].UserID = &dbEvent.UserID.UUID
+		}
+		if dbEvent.ProcessedAt.Valid {
+			events[i].ProcessedAt = &dbEvent.ProcessedAt.Time
+		}
+	}
+
+	respondWithJson(w, 200, events)
+}
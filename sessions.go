@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/babanini95/chirpy/internal/auth"
+	"github.com/babanini95/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Session is one logged-in device, identified by its refresh token family.
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+}
+
+func (cfg *apiConfig) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	rows, err := cfg.queries.GetRefreshTokensByUser(r.Context(), database.GetRefreshTokensByUserParams{
+		UserID: principal.UserID,
+		Now:    time.Now().UTC(),
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	respondWithJson(w, 200, sessionsFromRows(rows))
+}
+
+func sessionsFromRows(rows []database.GetRefreshTokensByUserRow) []Session {
+	sessions := make([]Session, len(rows))
+	for i, row := range rows {
+		sessions[i] = Session{
+			ID:         row.FamilyID,
+			CreatedAt:  row.CreatedAt,
+			LastUsedAt: row.LastUsedAt,
+			ExpiresAt:  row.ExpiresAt,
+			UserAgent:  row.UserAgent,
+			IPAddress:  row.IpAddress,
+		}
+	}
+	return sessions
+}
+
+func (cfg *apiConfig) revokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	sessionId, err := uuid.Parse(r.PathValue("sessionId"))
+	if err != nil {
+		respondWithError(w, 404, err.Error())
+		return
+	}
+
+	// scoping by user id means another user's session looks like a missing one
+	revoked, err := cfg.queries.RevokeRefreshTokenFamily(r.Context(), database.RevokeRefreshTokenFamilyParams{
+		FamilyID: sessionId,
+		UserID:   principal.UserID,
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, 404, "session not found")
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// revokeAllSessionsHandler signs the user out everywhere, apps included.
+func (cfg *apiConfig) revokeAllSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.queries.WithTx(tx)
+
+	err = qtx.RevokeAllRefreshTokensByUser(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	err = qtx.RevokeAllOAuthRefreshTokensByUser(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	w.WriteHeader(204)
+}
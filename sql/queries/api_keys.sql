@@ -0,0 +1,56 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (
+        id,
+        created_at,
+        user_id,
+        name,
+        key_hash,
+        hint,
+        scopes
+    )
+VALUES (gen_random_uuid(), NOW(), $1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: ListAPIKeysByUser :many
+SELECT *
+FROM api_keys
+WHERE user_id = $1
+    AND revoked_at IS NULL
+ORDER BY created_at DESC;
+
+-- name: GetAPIKeyByHash :one
+SELECT *
+FROM api_keys
+WHERE key_hash = $1
+    AND revoked_at IS NULL;
+
+-- name: TouchAPIKey :exec
+-- Records that a key was used, at most once a minute per key.
+UPDATE api_keys
+SET last_used_at = NOW()
+WHERE id = $1
+    AND (
+        last_used_at IS NULL
+        OR last_used_at < NOW() - INTERVAL '1 minute'
+    );
+
+-- name: RenameAPIKey :one
+UPDATE api_keys
+SET name = $1
+WHERE id = $2
+    AND user_id = $3
+    AND revoked_at IS NULL
+RETURNING *;
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = NOW()
+WHERE id = $1
+    AND user_id = $2
+    AND revoked_at IS NULL;
+
+-- name: RevokeAllAPIKeysByUser :exec
+UPDATE api_keys
+SET revoked_at = NOW()
+WHERE user_id = $1
+    AND revoked_at IS NULL;
\ No newline at end of file
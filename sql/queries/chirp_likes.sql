@@ -0,0 +1,34 @@
+-- name: LikeChirp :exec
+INSERT INTO chirp_likes (chirp_id, user_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (chirp_id, user_id) DO NOTHING;
+
+-- name: UnlikeChirp :exec
+DELETE FROM chirp_likes
+WHERE chirp_id = $1
+    AND user_id = $2;
+
+-- name: ListChirpLikes :many
+SELECT *
+FROM chirp_likes
+WHERE chirp_id = sqlc.arg('chirp_id')
+    AND (
+        sqlc.narg('cursor_created_at')::timestamp IS NULL
+        OR (created_at, user_id) < (
+            sqlc.narg('cursor_created_at')::timestamp,
+            sqlc.narg('cursor_user_id')::uuid
+        )
+    )
+ORDER BY created_at DESC,
+    user_id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetChirpLikeStats :many
+-- Counts the likes of a whole page of chirps at once. Chirps nobody liked
+-- have no row.
+SELECT chirp_id,
+    count(*) AS like_count,
+    COALESCE(bool_or(user_id = sqlc.narg('viewer_id')), false)::boolean AS liked_by_me
+FROM chirp_likes
+WHERE chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+GROUP BY chirp_id;
\ No newline at end of file
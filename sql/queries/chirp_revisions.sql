@@ -0,0 +1,11 @@
+-- name: CreateChirpRevision :exec
+-- Keeps a body that is being replaced. created_at is when that body was
+-- written, replaced_at when the edit happened.
+INSERT INTO chirp_revisions (id, chirp_id, body, created_at, replaced_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4);
+
+-- name: ListChirpRevisions :many
+SELECT *
+FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY replaced_at DESC;
\ No newline at end of file
@@ -1,12 +1,30 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
+-- A scheduled chirp has a publish time in the future.
+INSERT INTO chirps (
+        id,
+        created_at,
+        updated_at,
+        body,
+        user_id,
+        in_reply_to_id,
+        publish_at
+    )
+VALUES (
+        gen_random_uuid(),
+        sqlc.arg('created_at'),
+        sqlc.arg('created_at'),
+        sqlc.arg('body'),
+        sqlc.arg('user_id'),
+        sqlc.narg('in_reply_to_id'),
+        sqlc.arg('publish_at')
+    )
 RETURNING *;
 
--- name: GetChirps :many
-SELECT *
+-- name: CountChirpsByUserSince :one
+SELECT count(*)
 FROM chirps
-ORDER BY created_at ASC;
+WHERE user_id = $1
+    AND created_at >= $2;
 
 -- name: GetChirpsByUser :many
 SELECT *
@@ -14,11 +32,150 @@ FROM chirps
 WHERE user_id = $1
 ORDER BY created_at ASC;
 
+-- name: ListChirpsAsc :many
+SELECT *
+FROM chirps
+WHERE publish_at <= sqlc.arg('now')
+    AND (
+        sqlc.narg('author_id')::uuid IS NULL
+        OR user_id = sqlc.narg('author_id')
+    )
+    AND (
+        sqlc.narg('cursor_publish_at')::timestamp IS NULL
+        OR (publish_at, id) > (
+            sqlc.narg('cursor_publish_at')::timestamp,
+            sqlc.narg('cursor_id')::uuid
+        )
+    )
+ORDER BY publish_at ASC,
+    id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpsDesc :many
+SELECT *
+FROM chirps
+WHERE publish_at <= sqlc.arg('now')
+    AND (
+        sqlc.narg('author_id')::uuid IS NULL
+        OR user_id = sqlc.narg('author_id')
+    )
+    AND (
+        sqlc.narg('cursor_publish_at')::timestamp IS NULL
+        OR (publish_at, id) < (
+            sqlc.narg('cursor_publish_at')::timestamp,
+            sqlc.narg('cursor_id')::uuid
+        )
+    )
+ORDER BY publish_at DESC,
+    id DESC
+LIMIT sqlc.arg('limit');
+
 -- name: GetChirpById :one
 SELECT *
 FROM chirps
 WHERE id = $1;
 
+-- name: ListChirpReplies :many
+SELECT *
+FROM chirps
+WHERE in_reply_to_id = sqlc.arg('chirp_id')::uuid
+    AND publish_at <= sqlc.arg('now')
+    AND (
+        sqlc.narg('cursor_publish_at')::timestamp IS NULL
+        OR (publish_at, id) > (
+            sqlc.narg('cursor_publish_at')::timestamp,
+            sqlc.narg('cursor_id')::uuid
+        )
+    )
+ORDER BY publish_at ASC,
+    id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: GetChirpThread :many
+-- Walks up to the start of the chirp's thread and down through its published
+-- replies, max_depth levels either way. Depth is negative for ancestors and
+-- positive for replies, of which the max_replies nearest are kept.
+WITH RECURSIVE ancestors AS (
+    SELECT chirps.*,
+        0 AS depth
+    FROM chirps
+    WHERE chirps.id = sqlc.arg('id')
+    UNION ALL
+    SELECT parent.*,
+        ancestors.depth - 1
+    FROM chirps parent
+        JOIN ancestors ON parent.id = ancestors.in_reply_to_id
+    WHERE ancestors.depth > -sqlc.arg('max_depth')::integer
+),
+descendants AS (
+    SELECT chirps.*,
+        0 AS depth
+    FROM chirps
+    WHERE chirps.id = sqlc.arg('id')
+    UNION ALL
+    SELECT reply.*,
+        descendants.depth + 1
+    FROM chirps reply
+        JOIN descendants ON reply.in_reply_to_id = descendants.id
+    WHERE reply.publish_at <= sqlc.arg('now')
+        AND descendants.depth < sqlc.arg('max_depth')::integer
+),
+replies AS (
+    SELECT id,
+        created_at,
+        updated_at,
+        body,
+        user_id,
+        edited_at,
+        in_reply_to_id,
+        publish_at,
+        depth
+    FROM descendants
+    WHERE depth > 0
+    ORDER BY depth,
+        publish_at,
+        id
+    LIMIT sqlc.arg('max_replies')
+)
+SELECT id,
+    created_at,
+    updated_at,
+    body,
+    user_id,
+    edited_at,
+    in_reply_to_id,
+    publish_at,
+    depth
+FROM ancestors
+UNION ALL
+SELECT id,
+    created_at,
+    updated_at,
+    body,
+    user_id,
+    edited_at,
+    in_reply_to_id,
+    publish_at,
+    depth
+FROM replies
+ORDER BY depth ASC,
+    publish_at ASC,
+    id ASC;
+
+-- name: GetChirpByIdForUpdate :one
+SELECT *
+FROM chirps
+WHERE id = $1
+FOR UPDATE;
+
+-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $1,
+    updated_at = $2,
+    edited_at = $2
+WHERE id = $3
+RETURNING *;
+
 -- name: DeleteChirpById :exec
 DELETE FROM chirps
 WHERE id = $1;
\ No newline at end of file
@@ -0,0 +1,19 @@
+-- name: CreateEmailVerificationToken :one
+INSERT INTO email_verification_tokens (
+        token_hash,
+        created_at,
+        user_id,
+        email,
+        expires_at,
+        used_at
+    )
+VALUES ($1, NOW(), $2, $3, $4, NULL)
+RETURNING *;
+
+-- name: ConsumeEmailVerificationToken :one
+UPDATE email_verification_tokens
+SET used_at = NOW()
+WHERE token_hash = sqlc.arg('token_hash')
+    AND used_at IS NULL
+    AND expires_at > sqlc.arg('now')
+RETURNING *;
\ No newline at end of file
@@ -0,0 +1,30 @@
+-- name: GetLoginAttempt :one
+SELECT *
+FROM login_attempts
+WHERE attempt_key = $1;
+
+-- name: RecordLoginFailure :one
+-- Counts one more failure for the key. A key whose last failure is older
+-- than reset_before starts counting again from one.
+INSERT INTO login_attempts (attempt_key, failures, locked_until, updated_at)
+VALUES (sqlc.arg('attempt_key'), 1, NULL, sqlc.arg('now')) ON CONFLICT (attempt_key) DO
+UPDATE
+SET failures = CASE
+        WHEN login_attempts.updated_at < sqlc.arg('reset_before')::timestamp THEN 1
+        ELSE login_attempts.failures + 1
+    END,
+    locked_until = CASE
+        WHEN login_attempts.updated_at < sqlc.arg('reset_before')::timestamp THEN NULL
+        ELSE login_attempts.locked_until
+    END,
+    updated_at = sqlc.arg('now')
+RETURNING *;
+
+-- name: LockLoginAttempt :exec
+UPDATE login_attempts
+SET locked_until = $1
+WHERE attempt_key = $2;
+
+-- name: DeleteLoginAttempt :exec
+DELETE FROM login_attempts
+WHERE attempt_key = $1;
\ No newline at end of file
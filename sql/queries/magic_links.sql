@@ -0,0 +1,12 @@
+-- name: CreateMagicLink :exec
+INSERT INTO magic_links (id, created_at, user_id, email, expires_at, used_at)
+VALUES ($1, NOW(), $2, $3, $4, NULL);
+
+-- name: ConsumeMagicLink :one
+UPDATE magic_links
+SET used_at = NOW()
+WHERE id = sqlc.arg('id')
+    AND user_id = sqlc.arg('user_id')
+    AND used_at IS NULL
+    AND expires_at > sqlc.arg('now')
+RETURNING *;
\ No newline at end of file
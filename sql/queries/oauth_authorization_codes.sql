@@ -0,0 +1,20 @@
+-- name: CreateOAuthAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (
+        code_hash,
+        created_at,
+        client_id,
+        user_id,
+        redirect_uri,
+        scopes,
+        code_challenge,
+        expires_at
+    )
+VALUES ($1, NOW(), $2, $3, $4, $5, $6, $7);
+
+-- name: ConsumeOAuthAuthorizationCode :one
+UPDATE oauth_authorization_codes
+SET used_at = NOW()
+WHERE code_hash = sqlc.arg('code_hash')
+    AND used_at IS NULL
+    AND expires_at > sqlc.arg('now')
+RETURNING *;
\ No newline at end of file
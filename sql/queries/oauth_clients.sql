@@ -0,0 +1,32 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (
+        id,
+        created_at,
+        owner_id,
+        name,
+        secret_hash,
+        redirect_uris,
+        scopes
+    )
+VALUES (gen_random_uuid(), NOW(), $1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT *
+FROM oauth_clients
+WHERE id = $1
+    AND revoked_at IS NULL;
+
+-- name: ListOAuthClientsByOwner :many
+SELECT *
+FROM oauth_clients
+WHERE owner_id = $1
+    AND revoked_at IS NULL
+ORDER BY created_at DESC;
+
+-- name: RevokeOAuthClient :execrows
+UPDATE oauth_clients
+SET revoked_at = NOW()
+WHERE id = $1
+    AND owner_id = $2
+    AND revoked_at IS NULL;
\ No newline at end of file
@@ -0,0 +1,30 @@
+-- name: SaveOAuthConsent :one
+INSERT INTO oauth_consents (user_id, client_id, scopes, created_at, updated_at)
+VALUES ($1, $2, $3, NOW(), NOW())
+ON CONFLICT (user_id, client_id) DO UPDATE
+SET scopes = EXCLUDED.scopes,
+    updated_at = NOW()
+RETURNING *;
+
+-- name: GetOAuthConsent :one
+SELECT *
+FROM oauth_consents
+WHERE user_id = $1
+    AND client_id = $2;
+
+-- name: ListOAuthConsentsByUser :many
+SELECT oauth_consents.client_id,
+    oauth_clients.name AS client_name,
+    oauth_consents.scopes,
+    oauth_consents.created_at,
+    oauth_consents.updated_at
+FROM oauth_consents
+    JOIN oauth_clients ON oauth_clients.id = oauth_consents.client_id
+WHERE oauth_consents.user_id = $1
+    AND oauth_clients.revoked_at IS NULL
+ORDER BY oauth_consents.updated_at DESC;
+
+-- name: DeleteOAuthConsent :execrows
+DELETE FROM oauth_consents
+WHERE user_id = $1
+    AND client_id = $2;
\ No newline at end of file
@@ -0,0 +1,37 @@
+-- name: CreateOAuthRefreshToken :exec
+INSERT INTO oauth_refresh_tokens (
+        token_hash,
+        created_at,
+        client_id,
+        user_id,
+        scopes,
+        expires_at
+    )
+VALUES ($1, NOW(), $2, $3, $4, $5);
+
+-- name: ConsumeOAuthRefreshToken :one
+UPDATE oauth_refresh_tokens
+SET used_at = NOW()
+WHERE token_hash = sqlc.arg('token_hash')
+    AND used_at IS NULL
+    AND revoked_at IS NULL
+    AND expires_at > sqlc.arg('now')
+RETURNING *;
+
+-- name: GetOAuthRefreshToken :one
+SELECT *
+FROM oauth_refresh_tokens
+WHERE token_hash = $1;
+
+-- name: RevokeOAuthRefreshTokens :exec
+UPDATE oauth_refresh_tokens
+SET revoked_at = NOW()
+WHERE user_id = $1
+    AND client_id = $2
+    AND revoked_at IS NULL;
+
+-- name: RevokeAllOAuthRefreshTokensByUser :exec
+UPDATE oauth_refresh_tokens
+SET revoked_at = NOW()
+WHERE user_id = $1
+    AND revoked_at IS NULL;
\ No newline at end of file
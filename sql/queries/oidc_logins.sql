@@ -0,0 +1,24 @@
+-- name: CreateOIDCLogin :exec
+INSERT INTO oidc_logins (
+        state_hash,
+        created_at,
+        provider,
+        nonce,
+        code_verifier,
+        user_id,
+        expires_at
+    )
+VALUES ($1, NOW(), $2, $3, $4, $5, $6);
+
+-- name: ConsumeOIDCLogin :one
+UPDATE oidc_logins
+SET used_at = NOW()
+WHERE state_hash = sqlc.arg('state_hash')
+    AND provider = sqlc.arg('provider')
+    AND used_at IS NULL
+    AND expires_at > sqlc.arg('now')
+RETURNING *;
+
+-- name: DeleteExpiredOIDCLogins :execrows
+DELETE FROM oidc_logins
+WHERE expires_at <= $1;
\ No newline at end of file
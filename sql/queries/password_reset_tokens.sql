@@ -0,0 +1,18 @@
+-- name: CreatePasswordResetToken :one
+INSERT INTO password_reset_tokens (token_hash, created_at, user_id, expires_at, used_at)
+VALUES ($1, NOW(), $2, $3, NULL)
+RETURNING *;
+
+-- name: ConsumePasswordResetToken :one
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE token_hash = sqlc.arg('token_hash')
+    AND used_at IS NULL
+    AND expires_at > sqlc.arg('now')
+RETURNING *;
+
+-- name: InvalidatePasswordResetTokensByUser :exec
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE user_id = $1
+    AND used_at IS NULL;
\ No newline at end of file
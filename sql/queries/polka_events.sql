@@ -0,0 +1,50 @@
+-- name: ClaimPolkaEvent :execrows
+-- Records an event before it is applied. Affects no rows when the event was
+-- already received, which means the delivery is a replay, unless applying
+-- it failed last time and it may be tried again.
+INSERT INTO polka_events (
+        event_id,
+        event,
+        user_id,
+        payload,
+        status,
+        received_at
+    )
+VALUES ($1, $2, $3, $4, 'pending', NOW())
+ON CONFLICT (event_id) DO UPDATE
+SET received_at = NOW(),
+    status = 'pending',
+    error = NULL
+WHERE polka_events.status = 'failed';
+
+-- name: FinishPolkaEvent :exec
+UPDATE polka_events
+SET status = $1,
+    processed_at = NOW()
+WHERE event_id = $2;
+
+-- name: FailPolkaEvent :exec
+-- Keeps a record of an event that could not be applied. It runs after the
+-- transaction that claimed the event was rolled back.
+INSERT INTO polka_events (
+        event_id,
+        event,
+        user_id,
+        payload,
+        status,
+        error,
+        received_at
+    )
+VALUES ($1, $2, $3, $4, 'failed', $5, NOW())
+ON CONFLICT (event_id) DO UPDATE
+SET received_at = NOW(),
+    error = EXCLUDED.error
+WHERE polka_events.status = 'failed';
+
+-- name: ListPolkaEvents :many
+SELECT *
+FROM polka_events
+WHERE sqlc.narg('user_id')::uuid IS NULL
+    OR user_id = sqlc.narg('user_id')
+ORDER BY received_at DESC
+LIMIT sqlc.arg('limit');
\ No newline at end of file
@@ -1,27 +1,69 @@
--- name: GetRefreshToken :one
-SELECT *
-FROM refresh_tokens
-WHERE user_id = $1;
+-- name: GetRefreshTokensByUser :many
+-- Lists one row per live session: the unused token at the head of each
+-- family, joined with the family's first token for the login time.
+SELECT active.family_id,
+    root.created_at,
+    active.created_at AS last_used_at,
+    active.expires_at,
+    active.user_agent,
+    active.ip_address
+FROM refresh_tokens active
+    JOIN refresh_tokens root ON root.family_id = active.family_id
+    AND root.parent_token_hash IS NULL
+WHERE active.user_id = sqlc.arg('user_id')
+    AND active.used_at IS NULL
+    AND active.revoked_at IS NULL
+    AND active.expires_at > sqlc.arg('now')
+ORDER BY active.created_at DESC;
 
 -- name: SaveRefreshToken :one
 INSERT INTO refresh_tokens (
-        token,
+        token_hash,
         created_at,
         updated_at,
         user_id,
         expires_at,
-        revoked_at
+        revoked_at,
+        family_id,
+        parent_token_hash,
+        user_agent,
+        ip_address
     )
-VALUES ($1, NOW(), NOW(), $2, $3, NULL)
+VALUES ($1, NOW(), NOW(), $2, $3, NULL, $4, $5, $6, $7)
 RETURNING *;
 
 -- name: GetUserFromRefreshTokens :one
 SELECT *
 FROM refresh_tokens
-WHERE token = $1;
+WHERE token_hash = $1;
+
+-- name: ConsumeRefreshToken :one
+UPDATE refresh_tokens
+SET used_at = NOW(),
+    updated_at = NOW()
+WHERE token_hash = sqlc.arg('token_hash')
+    AND used_at IS NULL
+    AND revoked_at IS NULL
+    AND expires_at > sqlc.arg('now')
+RETURNING *;
 
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW(),
     updated_at = NOW()
-WHERE token = $1;
\ No newline at end of file
+WHERE token_hash = $1;
+
+-- name: RevokeRefreshTokenFamily :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(),
+    updated_at = NOW()
+WHERE family_id = $1
+    AND user_id = $2
+    AND revoked_at IS NULL;
+
+-- name: RevokeAllRefreshTokensByUser :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(),
+    updated_at = NOW()
+WHERE user_id = $1
+    AND revoked_at IS NULL;
\ No newline at end of file
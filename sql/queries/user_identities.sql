@@ -0,0 +1,37 @@
+-- name: CreateUserIdentity :one
+INSERT INTO user_identities (
+        id,
+        created_at,
+        user_id,
+        provider,
+        subject,
+        email,
+        last_login_at
+    )
+VALUES (gen_random_uuid(), NOW(), $1, $2, $3, $4, NOW())
+RETURNING *;
+
+-- name: GetUserIdentity :one
+SELECT *
+FROM user_identities
+WHERE provider = $1
+    AND subject = $2;
+
+-- name: TouchUserIdentity :exec
+-- Keeps the email the provider last reported, for the user to recognise
+-- which account is linked.
+UPDATE user_identities
+SET email = $1,
+    last_login_at = NOW()
+WHERE id = $2;
+
+-- name: ListUserIdentitiesByUser :many
+SELECT *
+FROM user_identities
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: DeleteUserIdentity :execrows
+DELETE FROM user_identities
+WHERE id = $1
+    AND user_id = $2;
\ No newline at end of file
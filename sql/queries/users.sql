@@ -12,21 +12,115 @@ RETURNING *;
 -- name: ResetUser :exec
 TRUNCATE TABLE users;
 
+-- name: GetUserById :one
+SELECT *
+FROM users
+WHERE id = $1;
+
+-- name: GetUserByIdForUpdate :one
+SELECT *
+FROM users
+WHERE id = $1
+FOR UPDATE;
+
 -- name: GetUserByEmail :one
 SELECT *
 FROM users
 WHERE email = $1;
 
--- name: UpdateEmailAndPassword :one
+-- name: UpdateEmail :one
+UPDATE users
+SET email_verified_at = CASE
+        WHEN email = $1 THEN email_verified_at
+    END,
+    email = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: SetChirpyRedUntil :one
 UPDATE users
-SET email = $1,
-    hashed_password = $2,
+SET chirpy_red_until = $1,
     updated_at = NOW()
-WHERE id = $3
+WHERE id = $2
 RETURNING *;
 
--- name: UpgradeUserById :one
+-- name: UpdatePassword :one
 UPDATE users
-SET is_chirpy_red = TRUE
+SET hashed_password = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: MarkEmailVerified :one
+UPDATE users
+SET email_verified_at = NOW(),
+    updated_at = NOW()
 WHERE id = $1
-RETURNING *;
\ No newline at end of file
+    AND email = $2
+RETURNING *;
+
+-- name: SetTOTPSecret :one
+UPDATE users
+SET totp_secret = $1,
+    totp_enabled_at = NULL,
+    totp_last_step = NULL,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: EnableTOTP :one
+UPDATE users
+SET totp_enabled_at = NOW(),
+    totp_last_step = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: UseTOTPStep :execrows
+-- Records the step of an accepted code. Affects no rows when that step or a
+-- later one was already used, which means the code is being replayed.
+UPDATE users
+SET totp_last_step = $1
+WHERE id = $2
+    AND (
+        totp_last_step IS NULL
+        OR totp_last_step < $1
+    );
+
+-- name: ScheduleUserDeletion :one
+UPDATE users
+SET delete_after = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: CancelUserDeletion :exec
+UPDATE users
+SET delete_after = NULL,
+    updated_at = NOW()
+WHERE id = $1
+    AND delete_after IS NOT NULL;
+
+-- name: DeleteUserById :exec
+DELETE FROM users
+WHERE id = $1;
+
+-- name: DeleteUsersDueForDeletion :many
+-- Hard deletes accounts whose grace period is over. Everything the user
+-- owns cascades.
+DELETE FROM users
+WHERE delete_after <= $1
+RETURNING email;
+
+-- name: SetUserRole :one
+UPDATE users
+SET role = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: CountUsersByRole :one
+SELECT count(*)
+FROM users
+WHERE role = $1;
\ No newline at end of file
@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+    RENAME COLUMN token TO token_hash;
+
+ALTER TABLE refresh_tokens
+    RENAME COLUMN parent_token TO parent_token_hash;
+
+-- rehash existing rows in place so live sessions keep working
+UPDATE refresh_tokens
+SET token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex'),
+    parent_token_hash = encode(sha256(convert_to(parent_token_hash, 'UTF8')), 'hex');
+
+-- +goose Down
+-- digests can not be turned back into tokens, so every session is dropped
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+    RENAME COLUMN parent_token_hash TO parent_token;
+
+ALTER TABLE refresh_tokens
+    RENAME COLUMN token_hash TO token;
\ No newline at end of file
@@ -0,0 +1,42 @@
+-- +goose Up
+-- lowercase the domain of existing emails like NormalizeEmail does, leaving
+-- any that would collide with another account as they are
+WITH normalized AS (
+    SELECT id,
+        substring(email FROM '^(.*)@') || '@' || lower(substring(email FROM '@([^@]*)$')) AS email
+    FROM users
+    WHERE email LIKE '%@%'
+)
+UPDATE users
+SET email = normalized.email
+FROM normalized
+WHERE normalized.id = users.id
+    AND normalized.email <> users.email
+    AND NOT EXISTS (
+        SELECT 1
+        FROM normalized other
+        WHERE other.id <> users.id
+            AND other.email = normalized.email
+    );
+
+ALTER TABLE users
+ADD COLUMN email_verified_at TIMESTAMP;
+
+-- existing accounts never got a link to verify with, so they count as
+-- verified from signup
+UPDATE users SET email_verified_at = created_at;
+
+CREATE TABLE email_verification_tokens (
+    token_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+    email TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE email_verification_tokens;
+
+ALTER TABLE users DROP COLUMN email_verified_at;
\ No newline at end of file
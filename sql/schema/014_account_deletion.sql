@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN delete_after TIMESTAMP;
+
+CREATE INDEX users_delete_after_idx ON users (delete_after)
+WHERE delete_after IS NOT NULL;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN delete_after;
\ No newline at end of file
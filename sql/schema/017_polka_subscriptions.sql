@@ -0,0 +1,39 @@
+-- +goose Up
+ALTER TABLE polka_events
+ADD COLUMN user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+ADD COLUMN payload JSONB NOT NULL DEFAULT '{}',
+ADD COLUMN status TEXT NOT NULL DEFAULT 'processed',
+ADD COLUMN error TEXT,
+ADD COLUMN processed_at TIMESTAMP;
+
+CREATE INDEX polka_events_received_at_idx ON polka_events (received_at DESC);
+
+ALTER TABLE users
+ADD COLUMN chirpy_red_until TIMESTAMP;
+
+-- Polka never told us when existing subscriptions end, so they run for one
+-- more billing period and are extended by the next renewal event.
+UPDATE users
+SET chirpy_red_until = NOW() + INTERVAL '30 days'
+WHERE is_chirpy_red;
+
+ALTER TABLE users DROP COLUMN is_chirpy_red;
+
+-- +goose Down
+ALTER TABLE users
+ADD COLUMN is_chirpy_red BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE users
+SET is_chirpy_red = chirpy_red_until > NOW()
+WHERE chirpy_red_until IS NOT NULL;
+
+ALTER TABLE users DROP COLUMN chirpy_red_until;
+
+DROP INDEX polka_events_received_at_idx;
+
+ALTER TABLE polka_events
+DROP COLUMN user_id,
+DROP COLUMN payload,
+DROP COLUMN status,
+DROP COLUMN error,
+DROP COLUMN processed_at;
\ No newline at end of file
@@ -0,0 +1,34 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN publish_at TIMESTAMP;
+
+-- scheduled chirps stored their publish time as created_at
+UPDATE chirps
+SET publish_at = created_at,
+    created_at = LEAST(created_at, updated_at);
+
+ALTER TABLE chirps
+ALTER COLUMN publish_at SET NOT NULL;
+
+DROP INDEX chirps_user_id_created_at_id_idx;
+DROP INDEX chirps_created_at_id_idx;
+CREATE INDEX chirps_publish_at_id_idx ON chirps (publish_at, id);
+CREATE INDEX chirps_user_id_publish_at_id_idx ON chirps (user_id, publish_at, id);
+
+DROP INDEX chirps_in_reply_to_id_idx;
+CREATE INDEX chirps_in_reply_to_id_idx ON chirps (in_reply_to_id, publish_at, id);
+
+-- +goose Down
+DROP INDEX chirps_in_reply_to_id_idx;
+CREATE INDEX chirps_in_reply_to_id_idx ON chirps (in_reply_to_id, created_at, id);
+
+DROP INDEX chirps_user_id_publish_at_id_idx;
+DROP INDEX chirps_publish_at_id_idx;
+CREATE INDEX chirps_created_at_id_idx ON chirps (created_at, id);
+CREATE INDEX chirps_user_id_created_at_id_idx ON chirps (user_id, created_at, id);
+
+UPDATE chirps
+SET created_at = publish_at;
+
+ALTER TABLE chirps
+DROP COLUMN publish_at;
\ No newline at end of file
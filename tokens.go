@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/babanini95/chirpy/internal/auth"
+	"github.com/babanini95/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	accessTokenTTL  = time.Hour
+	refreshTokenTTL = 60 * 24 * time.Hour
+)
+
+// clientInfo describes the device a refresh token was handed to.
+type clientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+func clientInfoFromRequest(r *http.Request) clientInfo {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return clientInfo{
+		UserAgent: r.UserAgent(),
+		IPAddress: ip,
+	}
+}
+
+// issueRefreshToken stores a new refresh token in familyID, replacing parentHash.
+func issueRefreshToken(ctx context.Context, q *database.Queries, userID, familyID uuid.UUID, parentHash sql.NullString, client clientInfo) (string, error) {
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = q.SaveRefreshToken(ctx, database.SaveRefreshTokenParams{
+		TokenHash:       auth.HashToken(refreshToken),
+		UserID:          userID,
+		ExpiresAt:       time.Now().UTC().Add(refreshTokenTTL),
+		FamilyID:        familyID,
+		ParentTokenHash: parentHash,
+		UserAgent:       client.UserAgent,
+		IpAddress:       client.IPAddress,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return refreshToken, nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/babanini95/chirpy/internal/auth"
+	"github.com/babanini95/chirpy/internal/database"
+)
+
+const (
+	totpIssuer         = "Chirpy"
+	mfaTokenTTL        = 5 * time.Minute
+	recoveryCodesCount = 10
+)
+
+func (cfg *apiConfig) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	user, err := cfg.queries.GetUserById(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 404, err.Error())
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		respondWithError(w, 409, "two-factor authentication is already enabled")
+		return
+	}
+
+	// enrolling again before confirming simply replaces the pending secret
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	_, err = cfg.queries.SetTOTPSecret(r.Context(), database.SetTOTPSecretParams{
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+		ID:         user.ID,
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	type respData struct {
+		Secret          string `json:"secret"`
+		ProvisioningURI string `json:"provisioning_uri"`
+	}
+	respondWithJson(w, 200, respData{
+		Secret:          secret,
+		ProvisioningURI: auth.TOTPProvisioningURI(secret, totpIssuer, user.Email),
+	})
+}
+
+func (cfg *apiConfig) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	type reqBody struct {
+		Code string `json:"code"`
+	}
+	reqData := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&reqData)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	user, err := cfg.queries.GetUserById(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 404, err.Error())
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		respondWithError(w, 409, "two-factor authentication is already enabled")
+		return
+	}
+	if !user.TotpSecret.Valid {
+		respondWithError(w, 400, "enroll before confirming")
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(user.TotpSecret.String, reqData.Code, time.Now())
+	if !ok {
+		respondWithError(w, 400, "invalid code")
+		return
+	}
+
+	recoveryCodes, err := auth.GenerateRecoveryCodes(recoveryCodesCount)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.queries.WithTx(tx)
+
+	_, err = qtx.EnableTOTP(r.Context(), database.EnableTOTPParams{
+		TotpLastStep: sql.NullInt64{Int64: step, Valid: true},
+		ID:           user.ID,
+	})
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	err = qtx.DeleteRecoveryCodesByUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	for _, code := range recoveryCodes {
+		err = qtx.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+			UserID:   user.ID,
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(code)),
+		})
+		if err != nil {
+			respondWithError(w, 500, err.Error())
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	type respData struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	respondWithJson(w, 200, respData{RecoveryCodes: recoveryCodes})
+}
+
+// respondWithMFAChallenge answers a correct password with a two-factor challenge.
+func (cfg *apiConfig) respondWithMFAChallenge(w http.ResponseWriter, user database.User) {
+	mfaToken, err := cfg.jwtKeys.MakeMFAToken(user.ID, mfaTokenTTL)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+
+	type respData struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+	respondWithJson(w, 200, respData{MFARequired: true, MFAToken: mfaToken})
+}
+
+func (cfg *apiConfig) loginSecondFactorHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	type reqBody struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	reqData := reqBody{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&reqData)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	userId, err := cfg.jwtKeys.ValidateMFAToken(reqData.MFAToken)
+	if err != nil {
+		respondWithError(w, 401, err.Error())
+		return
+	}
+	user, err := cfg.queries.GetUserById(r.Context(), userId)
+	if err != nil || !user.TotpEnabledAt.Valid {
+		respondWithError(w, 401, "two-factor authentication is not enabled")
+		return
+	}
+	// wrong codes count towards the same lockout as wrong passwords
+	if !cfg.checkLoginLockout(w, r, user.Email) {
+		return
+	}
+
+	switch {
+	case reqData.Code != "":
+		step, ok := auth.ValidateTOTP(user.TotpSecret.String, reqData.Code, time.Now())
+		if !ok {
+			cfg.recordLoginFailure(r, user.Email)
+			respondWithError(w, 401, "invalid code")
+			return
+		}
+		used, err := cfg.queries.UseTOTPStep(r.Context(), database.UseTOTPStepParams{
+			TotpLastStep: sql.NullInt64{Int64: step, Valid: true},
+			ID:           user.ID,
+		})
+		if err != nil {
+			respondWithError(w, 500, err.Error())
+			return
+		}
+		if used == 0 {
+			cfg.recordLoginFailure(r, user.Email)
+			respondWithError(w, 401, "code already used")
+			return
+		}
+	case reqData.RecoveryCode != "":
+		used, err := cfg.queries.ConsumeRecoveryCode(r.Context(), database.ConsumeRecoveryCodeParams{
+			UserID:   user.ID,
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(reqData.RecoveryCode)),
+		})
+		if err != nil {
+			respondWithError(w, 500, err.Error())
+			return
+		}
+		if used == 0 {
+			cfg.recordLoginFailure(r, user.Email)
+			respondWithError(w, 401, "invalid recovery code")
+			return
+		}
+	default:
+		respondWithError(w, 400, "code or recovery_code is required")
+		return
+	}
+
+	cfg.recordLoginSuccess(r, user.Email)
+	cfg.respondWithLogin(w, r, user)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/babanini95/chirpy/internal/database"
+	"github.com/babanini95/chirpy/internal/validate"
+	"github.com/lib/pq"
+)
+
+// validateCredentials normalizes the email in place and checks both fields.
+func (cfg *apiConfig) validateCredentials(reqData *authReqBody) validate.FieldErrors {
+	errs := validate.FieldErrors{}
+	email, err := validate.NormalizeEmail(reqData.Email)
+	if err != nil {
+		errs.Add("email", err.Error())
+	}
+	reqData.Email = email
+
+	if err := cfg.passwordPolicy.Check(reqData.Password); err != nil {
+		errs.Add("password", err.Error())
+	}
+	return errs
+}
+
+// lookupEmail normalizes a typed email, using invalid input as is.
+func lookupEmail(email string) string {
+	normalized, err := validate.NormalizeEmail(email)
+	if err != nil {
+		return email
+	}
+	return normalized
+}
+
+// findUserByEmail looks up the account for a typed email, trying the exact
+// address before the normalized one.
+func findUserByEmail(ctx context.Context, q *database.Queries, email string) (database.User, error) {
+	user, err := q.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		if normalized := lookupEmail(email); normalized != email {
+			return q.GetUserByEmail(ctx, normalized)
+		}
+	}
+	return user, err
+}
+
+func respondWithFieldErrors(w http.ResponseWriter, errs validate.FieldErrors) error {
+	type respData struct {
+		Error  string               `json:"error"`
+		Fields validate.FieldErrors `json:"fields"`
+	}
+	return respondWithJson(w, 422, respData{Error: "validation failed", Fields: errs})
+}
+
+// isUniqueViolation reports whether err comes from a unique constraint.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}